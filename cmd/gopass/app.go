@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -19,9 +21,15 @@ func Run(args []string) int {
 func runCLI() int {
 	var configFlag string
 	var config string
+	stdin = bufio.NewReader(os.Stdin)
 	flag.StringVar(&configFlag, "config", "", "Config for the vault file (Format: <filepath>:<password>)")
 	flag.Parse()
 
+	// commands that don't need an open vault
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		return runKeygen(os.Args[2:])
+	}
+
 	if configFlag != "" {
 		parts := strings.Split(configFlag, ":")
 		if len(parts) == 0 {
@@ -43,23 +51,64 @@ func runCLI() int {
 		}
 	}
 
+	if len(os.Args) > 2 && os.Args[1] == "recovery" && os.Args[2] == "combine" {
+		return runRecoveryCombine(config, os.Args[3:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		return runFsck(config, os.Args[2:])
+	}
+
 	lastVault, err := vault.GetLastVaultFilePath()
 	if err != nil {
 		fmt.Println(err)
 	}
-	if err := vault.ClearOldVaultPasswordIfNeeded(lastVault, config); err != nil {
+	if cleared, err := vault.ClearOldVaultPasswordIfNeeded(lastVault, config); err != nil {
 		fmt.Println("Error clearing old vault password:", err)
+	} else if cleared {
+		fmt.Println(common.Yellow+"Clearing cached password for old vault:"+common.Reset, lastVault)
 	}
 
-	v, err := vault.Load(config)
+	if _, err := os.Stat(config); errors.Is(err, os.ErrNotExist) {
+		fmt.Println(common.Blue + "Vault file not found. Creating new vault." + common.Reset)
+	}
+	v, err := vault.LoadWithIO(config, vaultIO)
 	if err != nil {
+		if errors.Is(err, vault.ErrIntegrity) {
+			fmt.Println(common.Red + "The vault file failed its integrity check, it was corrupted or tampered with. Run 'gopass fsck' to diagnose it." + common.Reset)
+		}
 		fmt.Println("An error while loading file: ", err)
 		return 1
 	}
+	defer v.Close()
+	setAttachmentLimit(v)
 	if err := vault.SetLastVaultFilePath(config); err != nil {
 		fmt.Println("Warning: failed to update last vault file:", err)
 	}
 
+	// a command writes the vault once when it is done, however many
+	// entries it changes, and a command that fails writes nothing
+	v.Begin()
+	code := runCommand(v, config)
+	if code != 0 && !(len(os.Args) > 1 && keepOnFailure[os.Args[1]]) {
+		if err := v.Discard(); err != nil {
+			fmt.Println(common.Red+"Failed to drop the changes:"+common.Reset, err)
+		}
+		return code
+	}
+	if err := v.Commit(); err != nil {
+		fmt.Println(common.Red+"Failed to save the vault:"+common.Reset, err)
+		return 1
+	}
+	return code
+}
+
+// keepOnFailure lists the commands whose changes are saved even when they
+// exit non-zero: audit reports its findings in the exit code after it has
+// read every entry, and that read belongs in the audit log.
+var keepOnFailure = map[string]bool{"audit": true}
+
+// runCommand runs the command in os.Args on an open vault.
+func runCommand(v *vault.Vault, config string) int {
 	if len(os.Args) < 2 {
 		fmt.Println("Welcome to Gopass, a simple password storage and encrypter.")
 		fmt.Println("Type 'gopass help' for more info.")
@@ -71,28 +120,49 @@ func runCLI() int {
 			case "vault":
 				fmt.Println(common.Cyan + "Current vault: " + common.Reset + config)
 			case "list":
-				if len(os.Args) > 2 && os.Args[2] == "-expose" {
-					v.List(os.Args[2])
-				} else {
-					v.List()
+				return runList(v, os.Args[2:])
+			case "find":
+				if len(os.Args) < 3 {
+					fmt.Println(common.Red + "Usage: gopass find <text>" + common.Reset)
+					return 1
+				}
+				for _, name := range v.Find(os.Args[2]) {
+					fmt.Println("|> " + common.Blue + name + common.Reset)
 				}
 			case "export":
-				v.Export(os.Args[2])
+				return runExport(v, os.Args[2:])
 			case "import":
-				file, err := os.ReadFile(os.Args[2])
-				if err != nil {
-					fmt.Printf("Error opening file: %v", os.Args[2])
-				}
-				v.Import(file, config)
+				return runImport(v, config, os.Args[2:])
 			case "add":
-				v.Add(os.Args[2], os.Args[3], config)
-			case "remove":
-				v.Remove(os.Args[2], config)
+				return runAdd(v, config, os.Args[2:])
+			case "remove", "rm":
+				return runRemove(v, config, os.Args[2:])
+			case "undelete":
+				return runUndelete(v, config, os.Args[2:])
+			case "trash":
+				return runTrash(v, config, os.Args[2:])
 			case "get":
-				_, err := v.Get(os.Args[2])
-				if err != nil {
-					fmt.Println(err)
-				}
+				return runGet(v, os.Args[2:])
+			case "attach":
+				return runAttach(v, config, os.Args[2:])
+			case "attachments":
+				return runAttachments(v, os.Args[2:])
+			case "extract":
+				return runExtract(v, os.Args[2:])
+			case "expire":
+				return runExpire(v, config, os.Args[2:])
+			case "expiring":
+				return runExpiring(v, os.Args[2:])
+			case "log":
+				return runLog(v, config, os.Args[2:])
+			case "audit":
+				return runAudit(v, os.Args[2:])
+			case "otp":
+				return runOTP(v, config, os.Args[2:])
+			case "recipients":
+				return runRecipients(v, config, os.Args[2:])
+			case "recovery":
+				return runRecovery(v, config, os.Args[2:])
 			case "-config":
 				fmt.Println(common.Green + "Switching vault to " + config + common.Reset)
 			default:
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// setAttachmentLimit applies attachment_limit from .gopassrc to the vault,
+// for attach and for every import that brings attachments along.
+func setAttachmentLimit(v *vault.Vault) {
+	limit, _ := vault.GetConfigValue("attachment_limit")
+	if limit == "" {
+		return
+	}
+	size, err := parseSize(limit)
+	if err != nil {
+		fmt.Println(common.Yellow+"WARNING: "+common.Reset+"invalid attachment_limit in .gopassrc, using the default:", err)
+		return
+	}
+	v.SetAttachmentLimit(size)
+}
+
+func runAttach(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	name := fs.String("name", "", "Name of the attachment (default: the file's base name)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 2 {
+		fmt.Println(common.Red + "Usage: gopass attach <key> <file> [-name attachment]" + common.Reset)
+		return 1
+	}
+
+	attachment := *name
+	if attachment == "" {
+		attachment = filepath.Base(pos[1])
+	}
+	info, err := os.Stat(pos[1])
+	if err != nil {
+		fmt.Printf("Error opening file: %v\n", pos[1])
+		return 1
+	}
+	if info.Size() > v.AttachmentLimit() {
+		fmt.Printf(common.Red+"%s is %d bytes, the attachment limit is %d (set attachment_limit in ~/.gopassrc)\n"+common.Reset, pos[1], info.Size(), v.AttachmentLimit())
+		return 1
+	}
+	content, err := os.ReadFile(pos[1])
+	if err != nil {
+		fmt.Printf("Error opening file: %v\n", pos[1])
+		return 1
+	}
+	err = v.Attach(pos[0], attachment, content, config)
+	clear(content)
+	if err != nil {
+		fmt.Println(common.Red+"Error attaching file:"+common.Reset, err)
+		return 1
+	}
+	fmt.Println(common.Green + "Attached " + common.Reset + attachment + common.Green + " to " + common.Reset + pos[0])
+	return 0
+}
+
+func runAttachments(v *vault.Vault, args []string) int {
+	if len(args) != 1 {
+		fmt.Println(common.Red + "Usage: gopass attachments <key>" + common.Reset)
+		return 1
+	}
+	list, err := v.Attachments(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(list) == 0 {
+		fmt.Println(common.Yellow + "No attachments on " + args[0] + common.Reset)
+		return 0
+	}
+	for _, a := range list {
+		fmt.Printf("|> "+common.Blue+"%s"+common.Reset+" (%d bytes)\n", a.Name, a.Size)
+	}
+	return 0
+}
+
+func runExtract(v *vault.Vault, args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	out := fs.String("o", "", "Where to write the attachment, '-' for stdout (default: the attachment name)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 2 {
+		fmt.Println(common.Red + "Usage: gopass extract <key> <attachment> [-o path]" + common.Reset)
+		return 1
+	}
+
+	content, err := v.Attachment(pos[0], pos[1])
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer clear(content)
+	v.LogRead("extract", pos[0], pos[1])
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(content)
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Base(pos[1])
+	}
+	if err := vault.WritePrivateFile(path, content); err != nil {
+		fmt.Println(common.Red+"Error writing attachment:"+common.Reset, err)
+		return 1
+	}
+	fmt.Println(common.Green + "Extracted " + common.Reset + pos[1] + common.Green + " to " + common.Reset + path)
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prozod/gopass/internal/audit"
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// exitAuditFindings is returned by 'gopass audit' when any entry has a
+// problem, like 'gopass expiring'.
+const exitAuditFindings = 2
+
+func runAudit(v *vault.Vault, args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	maxAge := fs.String("max-age", "365d", "Flag passwords unchanged for longer than this (0 disables)")
+	breachDB := fs.String("breach-db", "", "Sorted HIBP SHA-1 file or directory of range files to check against")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	age, err := parseDuration(*maxAge)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	opts := audit.Options{MaxAge: age, Now: v.IO().Now()}
+	if *breachDB != "" {
+		db, err := audit.OpenBreachDB(*breachDB)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		defer db.Close()
+		opts.Breaches = db
+	}
+
+	report := audit.Run(v, opts)
+	v.LogRead("audit", "", fmt.Sprintf("%d entries checked", len(report.Entries)))
+	code := 0
+	if report.Weak+report.Reused+report.Old+report.Breached > 0 {
+		code = exitAuditFindings
+	}
+	for _, f := range report.Entries {
+		if f.Error != "" {
+			code = 1
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return code
+	}
+
+	for _, f := range report.Entries {
+		if f.Error != "" {
+			fmt.Printf("|> "+common.Blue+"%s"+common.Reset+" "+common.Red+"error: %s"+common.Reset+"\n", f.Name, f.Error)
+			continue
+		}
+		if f.OK() {
+			fmt.Printf("|> "+common.Blue+"%s"+common.Reset+" "+common.Green+"ok"+common.Reset+" (%.0f bits)\n", f.Name, f.Strength.Entropy)
+			continue
+		}
+		fmt.Printf("|> "+common.Blue+"%s"+common.Reset+"\n", f.Name)
+		if f.Weak {
+			fmt.Printf("   "+common.Red+"weak"+common.Reset+" (%.0f bits): %s\n", f.Strength.Entropy, strings.Join(f.Strength.Issues, ", "))
+		}
+		if len(f.ReusedWith) > 0 {
+			fmt.Println("   " + common.Red + "reused" + common.Reset + " by " + strings.Join(f.ReusedWith, ", "))
+		}
+		if f.Breached > 0 {
+			fmt.Printf("   "+common.Red+"breached"+common.Reset+": seen %d times in known breaches\n", f.Breached)
+		}
+		if f.Old {
+			fmt.Printf("   "+common.Yellow+"old"+common.Reset+": unchanged for %d days\n", f.AgeDays)
+		}
+	}
+	fmt.Printf("\n%d entries: %d weak, %d reused, %d old", report.Total, report.Weak, report.Reused, report.Old)
+	if opts.Breaches != nil {
+		fmt.Printf(", %d breached", report.Breached)
+	}
+	fmt.Println()
+	return code
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prozod/gopass/internal/vault"
+	"github.com/zalando/go-keyring"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestMain keeps every test away from the real keyring, home directory and
+// identity.
+func TestMain(m *testing.M) {
+	keyring.MockInit()
+	home, err := os.MkdirTemp("", "gopass-test-home")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+	os.Unsetenv("GOPASS_IDENTITY")
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// step is one gopass invocation of a CLI script.
+type step struct {
+	stdin string
+	args  string // split on spaces, $HOME is the script's home directory
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// runScript runs the steps in a fresh home directory, with a fake clipboard
+// and clock, and compares the transcript with testdata/<name>.golden.
+// Between steps, between(i) may change things as a user would.
+func runScript(t *testing.T, name string, steps []step, between func(i int, home string)) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	clip := &fakeClipboard{}
+	saved := vaultIO
+	vaultIO.Clipboard = clip
+	vaultIO.Now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { vaultIO = saved }()
+
+	var transcript bytes.Buffer
+	for i, s := range steps {
+		if between != nil {
+			between(i, home)
+		}
+		args := strings.Fields(strings.ReplaceAll(s.args, "$HOME", home))
+		out, code := cli(t, s.stdin, args...)
+		fmt.Fprintf(&transcript, "$ gopass %s\n%s", s.args, strings.ReplaceAll(out, home, "$HOME"))
+		if code != 0 {
+			fmt.Fprintf(&transcript, "[exit %d]\n", code)
+		}
+		if clip.text != "" {
+			fmt.Fprintf(&transcript, "[clipboard %q]\n", clip.text)
+			clip.text = ""
+		}
+	}
+
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, transcript.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got := transcript.String(); got != string(want) {
+		t.Fatalf("transcript differs from %s (run go test -update to accept it):\n%s", golden, got)
+	}
+}
+
+// cli runs the command with args and stdin as given, and returns what it
+// printed to stdout and stderr without colours, and its exit code.
+func cli(t *testing.T, input string, args ...string) (string, int) {
+	t.Helper()
+	in, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if _, err := in.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+
+	oldStdin, oldStdout, oldStderr := os.Stdin, os.Stdout, os.Stderr
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	os.Stdin, os.Stdout, os.Stderr = in, w, w
+	os.Args = append([]string{"gopass"}, args...)
+	flag.CommandLine = flag.NewFlagSet("gopass", flag.ContinueOnError)
+	code := func() int {
+		defer func() {
+			os.Stdin, os.Stdout, os.Stderr = oldStdin, oldStdout, oldStderr
+			os.Args, flag.CommandLine = oldArgs, oldFlags
+		}()
+		return runCLI()
+	}()
+	w.Close()
+	return ansiEscape.ReplaceAllString(string(<-output), ""), code
+}
+
+func TestCLIEntries(t *testing.T) {
+	runScript(t, "entries", []step{
+		{stdin: "pw\n", args: "-config $HOME/vault.dat"},
+		{args: "add github token"},
+		{args: "add github other"},
+		{args: "add email"},
+		{args: "add email secret"},
+		{args: "list"},
+		{args: "list -expose"},
+		{args: "find GIT"},
+		{args: "get github"},
+		{args: "get missing"},
+		{args: "rm github"},
+		{args: "trash"},
+		{args: "undelete github"},
+		{args: "rm --force email"},
+		{args: "list"},
+		{args: "vault"},
+	}, nil)
+}
+
+func TestCLIPasswordPrompt(t *testing.T) {
+	runScript(t, "password", []step{
+		{stdin: "pw\n", args: "-config $HOME/vault.dat"},
+		{args: "add github token"},
+		{stdin: "bad\nworse\npw\n", args: "find git"},
+		{args: "find git"},
+		{stdin: "a\nb\nc\npw\n", args: "find git"},
+	}, func(i int, home string) {
+		// forget the cached password as if the keyring was cleared
+		if i == 2 || i == 4 {
+			_ = keyring.Delete("gopass", "vault:"+filepath.Join(home, "vault.dat"))
+		}
+	})
+}
+
+func TestCLIImport(t *testing.T) {
+	runScript(t, "import", []step{
+		{stdin: "pw\n", args: "-config $HOME/vault.dat"},
+		{args: "add github token"},
+		{args: "add email secret"},
+		{args: "import --dry-run $HOME/in.json"},
+		{stdin: "x\nr\nO\n", args: "import --on-conflict ask $HOME/in.json"},
+		{args: "list -expose"},
+		{stdin: "", args: "import --on-conflict ask $HOME/in.json"},
+	}, func(i int, home string) {
+		if i == 3 {
+			data := `{"github": "new", "email": "new", "aws": "key", "db": "pass"}`
+			if err := os.WriteFile(filepath.Join(home, "in.json"), []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCLIClock(t *testing.T) {
+	// RFC 6238 SHA1 seed "12345678901234567890"
+	uri := "otpauth://totp/GitHub:me?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	runScript(t, "clock", []step{
+		{stdin: "pw\n", args: "-config $HOME/vault.dat"},
+		{args: "add github token"},
+		{args: "otp gitlab -set " + uri},
+		{args: "otp github -set " + uri},
+		{args: "otp github"},
+		{args: "otp github -copy"},
+		{args: "expire github -in 10d"},
+		{args: "expiring -within 30d"},
+		{args: "expiring -within 1d"},
+	}, nil)
+}
+
+func TestCLIAttachmentLimit(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if _, code := cli(t, "pw\n", "-config", filepath.Join(home, "v.dat")); code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	if _, code := cli(t, "", "add", "server", "pw"); code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	rc, err := os.OpenFile(filepath.Join(home, ".gopassrc"), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(rc, "attachment_limit=4")
+	rc.Close()
+	file := filepath.Join(home, "key")
+	if err := os.WriteFile(file, []byte("12345"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, code := cli(t, "", "attach", "server", file)
+	if code == 0 || !strings.Contains(out, "the attachment limit is 4") {
+		t.Fatalf("attachment_limit from .gopassrc not applied (exit %d):\n%s", code, out)
+	}
+}
+
+func TestCLIFailedCommandWritesNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	vaultPath := filepath.Join(home, "v.dat")
+	if _, code := cli(t, "pw\n", "-config", vaultPath); code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	if _, code := cli(t, "", "add", "server", "pw"); code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	data, _ := os.ReadFile(vaultPath)
+	log, _ := os.ReadFile(vault.LogPath(vaultPath))
+
+	saved := vaultIO
+	vaultIO.Clipboard = brokenClipboard{}
+	_, code := cli(t, "", "get", "server")
+	vaultIO = saved
+	if code == 0 {
+		t.Fatal("get without a clipboard should fail")
+	}
+	if after, _ := os.ReadFile(vaultPath); !bytes.Equal(data, after) {
+		t.Fatal("the failed command wrote the vault")
+	}
+	if after, _ := os.ReadFile(vault.LogPath(vaultPath)); !bytes.Equal(log, after) {
+		t.Fatal("the failed command wrote the audit log")
+	}
+
+	// audit opts in: its exit code reports findings, the read is logged
+	if _, code := cli(t, "", "audit"); code != exitAuditFindings {
+		t.Fatalf("audit of a weak password exited with %d", code)
+	}
+	if out, code := cli(t, "", "log"); code != 0 || !strings.Contains(out, "audit") {
+		t.Fatalf("audit wasn't logged (exit %d):\n%s", code, out)
+	}
+	if out, code := cli(t, "", "log", "verify"); code != 0 {
+		t.Fatalf("log doesn't verify (exit %d):\n%s", code, out)
+	}
+}
+
+func TestCLIStaysInHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	wd, _ := os.Getwd()
+	before, _ := os.ReadDir(wd)
+	if _, code := cli(t, "pw\n", "-config", filepath.Join(home, "v.dat")); code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	if after, _ := os.ReadDir(wd); len(after) != len(before) {
+		t.Fatal("the command wrote into the working directory")
+	}
+	if _, err := vault.GetVaultPathFromConfig(); err != nil {
+		t.Fatalf("the config wasn't written to the fake home: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// stdin is where the command reads answers, and passwords when stdin isn't
+// a terminal. Every read goes through it so a scripted stdin is consumed in
+// order. runCLI sets it.
+var stdin = bufio.NewReader(os.Stdin)
+
+// vaultIO is how the vaults the command opens reach the user.
+var vaultIO = vault.IO{Prompt: prompt{}}
+
+// prompt asks for passwords with the prompt in green. On a terminal the
+// password isn't echoed; otherwise it is the next line of stdin.
+type prompt struct{}
+
+func (prompt) Read(text string) (string, error) {
+	text = common.Green + text + common.Reset
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return vault.TerminalPasswordReader{}.Read(text)
+	}
+	fmt.Print(text)
+	line, err := stdin.ReadString('\n')
+	fmt.Println()
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runAdd(v *vault.Vault, config string, args []string) int {
+	if len(args) != 2 {
+		fmt.Println(common.Red + "Usage: gopass add <key> <value>" + common.Reset)
+		return 1
+	}
+	if err := v.Add(args[0], args[1], config); err != nil {
+		fmt.Println(common.Red + err.Error() + common.Reset)
+		return 1
+	}
+	fmt.Println(common.Green + "Added " + common.Reset + args[0] + common.Green + " to " + common.Reset + config)
+	return 0
+}
+
+func runGet(v *vault.Vault, args []string) int {
+	if len(args) != 1 {
+		fmt.Println(common.Red + "Usage: gopass get <key>" + common.Reset)
+		return 1
+	}
+	if _, err := v.Get(args[0]); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("Copied value for \"%s\" to clipboard.\n", args[0])
+	return 0
+}
+
+func runList(v *vault.Vault, args []string) int {
+	expose := len(args) > 0 && args[0] == "-expose"
+	fmt.Println(common.Green + "INFO: " + common.Reset + "Entries are separated by ':' (<" + common.Blue + "name" + common.Reset + ">:<" + common.Yellow + "value" + common.Reset + ">)")
+	fmt.Println()
+	fmt.Println("---------- VAULT STORAGE ----------")
+	switch {
+	case len(args) > 0 && !expose:
+		fmt.Printf(common.Yellow+"WARNING: "+common.Reset+"Unknown argument: %s\n", args[0])
+	case !expose:
+		fmt.Println(common.Purple + "Hidden mode, use flag '-expose' to display passwords." + common.Reset)
+	}
+	if len(args) == 0 || expose {
+		for _, n := range v.Names() {
+			value := strings.Repeat("*", 8)
+			if expose {
+				var err error
+				if value, err = v.Value(n); err != nil {
+					value = common.Red + err.Error()
+				} else {
+					v.LogRead("show", n, "list -expose")
+				}
+			}
+			fmt.Printf("|> "+common.Blue+"%s"+common.Reset+":"+common.Yellow+"%s"+common.Reset+"%s\n", n, value, expiryMark(v, n))
+		}
+	}
+	fmt.Println("-----------------------------------")
+	fmt.Println()
+	return 0
+}
+
+// expiryMark flags expired entries in list output.
+func expiryMark(v *vault.Vault, name string) string {
+	info, ok := v.Expiry(name)
+	if !ok || !info.Expired {
+		return ""
+	}
+	if info.Reason == "rotate" {
+		return common.Red + " [rotation overdue since " + info.Due.Format("2006-01-02") + "]" + common.Reset
+	}
+	return common.Red + " [expired " + info.Due.Format("2006-01-02") + "]" + common.Reset
+}
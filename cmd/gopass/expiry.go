@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// exitExpiring is returned by 'gopass expiring' when anything is due, so cron
+// jobs can alert on it.
+const exitExpiring = 2
+
+func runExpire(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("expire", flag.ContinueOnError)
+	on := fs.String("on", "", "Expiry date (YYYY-MM-DD)")
+	in := fs.String("in", "", "Expire after this long from now (e.g. 90d)")
+	rotate := fs.String("rotate", "", "Rotate every N days (e.g. 90d)")
+	clearAll := fs.Bool("clear", false, "Remove expiry and rotation policy")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 1 || (*on == "" && *in == "" && *rotate == "" && !*clearAll) {
+		fmt.Println(common.Red + "Usage: gopass expire <key> [--on YYYY-MM-DD | --in 90d] [--rotate 90d] | --clear" + common.Reset)
+		return 1
+	}
+
+	// start from the stored policy and only change what was asked for
+	var expires time.Time
+	var rotateDays int
+	if !*clearAll {
+		expires, rotateDays = v.ExpiryPolicy(pos[0])
+		switch {
+		case *on != "":
+			if expires, err = time.ParseInLocation("2006-01-02", *on, time.Local); err != nil {
+				fmt.Println(common.Red + "Invalid date, use YYYY-MM-DD." + common.Reset)
+				return 1
+			}
+		case *in != "":
+			d, err := parseDuration(*in)
+			if err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			expires = v.IO().Now().Add(d)
+		}
+		if *rotate != "" {
+			d, err := parseDuration(*rotate)
+			if err != nil || d < 24*time.Hour {
+				fmt.Println(common.Red + "Rotation period must be at least one day." + common.Reset)
+				return 1
+			}
+			rotateDays = int(d / (24 * time.Hour))
+		}
+	}
+
+	if err := v.SetExpiry(pos[0], expires, rotateDays, config); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if info, ok := v.Expiry(pos[0]); ok {
+		fmt.Printf(common.Green+"%s is due on %s (%s)"+common.Reset+"\n", pos[0], info.Due.Format("2006-01-02"), info.Reason)
+	} else {
+		fmt.Println(common.Green + "Cleared expiry of " + common.Reset + pos[0])
+	}
+	return 0
+}
+
+func runExpiring(v *vault.Vault, args []string) int {
+	fs := flag.NewFlagSet("expiring", flag.ContinueOnError)
+	within := fs.String("within", "30d", "List entries due within this duration")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	d, err := parseDuration(*within)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	due := v.Expiring(d)
+	if len(due) == 0 {
+		fmt.Println(common.Green + "Nothing expires within " + *within + common.Reset)
+		return 0
+	}
+	for _, info := range due {
+		state := common.Yellow + "due"
+		if info.Expired {
+			state = common.Red + "EXPIRED"
+		}
+		fmt.Printf("|> "+common.Blue+"%s"+common.Reset+" %s %s"+common.Reset+" (%s)\n", info.Name, state, info.Due.Format("2006-01-02"), info.Reason)
+	}
+	return exitExpiring
+}
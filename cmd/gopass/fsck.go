@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// cachedReader asks for the password once and reuses it, so checking the
+// vault and then its backups prompts a single time.
+type cachedReader struct {
+	reader   vault.PasswordReader
+	password *string
+}
+
+func (c *cachedReader) Read(prompt string) (string, error) {
+	if c.password == nil {
+		p, err := c.reader.Read(prompt)
+		if err != nil {
+			return "", err
+		}
+		c.password = &p
+	}
+	return *c.password, nil
+}
+
+// runFsck runs before the vault is loaded, since its whole point is files
+// that don't load.
+func runFsck(config string, args []string) int {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "Restore from the newest valid backup without asking")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	reader := &cachedReader{reader: prompt{}}
+
+	report, err := vault.Fsck(config, reader)
+	if err != nil {
+		fmt.Println(common.Red+"Cannot read vault file: "+common.Reset, err)
+	} else {
+		printFsckReport(report)
+		if report.OK() {
+			return 0
+		}
+	}
+
+	backups, err := vault.FsckBackups(config, reader)
+	if err != nil {
+		fmt.Println(common.Red+"Cannot check backups: "+common.Reset, err)
+		return 1
+	}
+	var good *vault.FsckReport
+	for _, b := range backups {
+		if b.OK() {
+			good = b
+			break
+		}
+	}
+	if good == nil {
+		fmt.Printf(common.Red+"No valid backup found (%d checked)."+common.Reset+"\n", len(backups))
+		return 1
+	}
+
+	fmt.Printf("Newest valid backup: "+common.Blue+"%s"+common.Reset+" from %s, %d entries.\n", good.Path, good.ModTime.Format("2006-01-02 15:04:05"), good.Entries)
+	if !*yes {
+		fmt.Print("Restore it? [y/N] ")
+		answer, _ := stdin.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing changed.")
+			return 1
+		}
+	}
+	damaged, err := vault.RestoreBackup(config, good.Path)
+	if err != nil {
+		fmt.Println(common.Red+"Restore failed: "+common.Reset, err)
+		return 1
+	}
+	if damaged != "" {
+		fmt.Println("The damaged file was kept as " + damaged)
+	}
+	fmt.Println(common.Green + "Restored " + common.Reset + config + common.Green + " from " + common.Reset + good.Path)
+	return 0
+}
+
+func printFsckReport(r *vault.FsckReport) {
+	fmt.Printf("Checking "+common.Blue+"%s"+common.Reset+" (format v%d)\n", r.Path, r.Version)
+	if r.OK() {
+		fmt.Printf(common.Green+"No problems found, %d entries."+common.Reset+"\n", r.Entries)
+		return
+	}
+	for _, p := range r.Problems {
+		fmt.Println("|> " + common.Red + "[" + p.Kind + "]" + common.Reset + " " + p.Detail)
+	}
+}
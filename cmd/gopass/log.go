@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+func runLog(v *vault.Vault, config string, args []string) int {
+	if len(args) > 0 && args[0] == "verify" {
+		problems, err := v.VerifyLog(config)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(problems) == 0 {
+			fmt.Println(common.Green + "Audit log is intact." + common.Reset)
+			return 0
+		}
+		for _, p := range problems {
+			fmt.Println(common.Red + "|> " + p + common.Reset)
+		}
+		return 1
+	}
+
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	entry := fs.String("entry", "", "Only show records about this entry")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fmt.Println(common.Red + "Usage: gopass log [--entry <key>] | gopass log verify" + common.Reset)
+		return 1
+	}
+	records, err := v.Log(config, *entry)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(records) == 0 {
+		fmt.Println(common.Green + "No audit records." + common.Reset)
+		return 0
+	}
+	for _, r := range records {
+		fmt.Printf("%5d %s "+common.Yellow+"%-7s"+common.Reset+" "+common.Blue+"%s"+common.Reset+" %s@%s", r.Seq, r.Time.Local().Format("2006-01-02 15:04:05"), r.Op, r.Entry, r.User, r.Host)
+		if r.Detail != "" {
+			fmt.Print(" (" + r.Detail + ")")
+		}
+		fmt.Println()
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+func runOTP(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("otp", flag.ContinueOnError)
+	set := fs.String("set", "", "Store an otpauth:// URI on the entry")
+	copyCode := fs.Bool("copy", false, "Copy the code to the clipboard instead of printing it")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 1 {
+		fmt.Println(common.Red + "Usage: gopass otp [-copy] <key> | gopass otp -set <otpauth uri> <key>" + common.Reset)
+		return 1
+	}
+	name := pos[0]
+
+	if *set != "" {
+		if err := v.SetOTP(name, *set, config); err != nil {
+			fmt.Println(common.Red+"Error storing OTP seed:"+common.Reset, err)
+			return 1
+		}
+		fmt.Println(common.Green + "Stored OTP seed for " + common.Reset + name)
+		return 0
+	}
+
+	code, remaining, err := v.OTP(name, v.IO().Now())
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if *copyCode {
+		if err := v.IO().Clipboard.WriteAll(code); err != nil {
+			fmt.Println("Failed to copy to clipboard:", err)
+			return 1
+		}
+		fmt.Printf("Copied OTP code for \"%s\" to clipboard (valid for %ds).\n", name, int(remaining.Seconds()))
+		return 0
+	}
+	fmt.Printf(common.Yellow+"%s"+common.Reset+" (valid for %ds)\n", code, int(remaining.Seconds()))
+	return 0
+}
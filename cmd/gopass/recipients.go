@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// runKeygen creates the local X25519 identity used to open shared vaults.
+func runKeygen(args []string) int {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	out := fs.String("o", "", "Where to write the identity (default $GOPASS_IDENTITY or ~/.gopass_identity)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		p, err := vault.IdentityPath()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		path = p
+	}
+
+	id, err := vault.GenerateIdentity()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := vault.SaveIdentity(path, id); err != nil {
+		if os.IsExist(err) {
+			fmt.Println(common.Red + "An identity already exists at " + path + ", refusing to overwrite it." + common.Reset)
+		} else {
+			fmt.Println("Error writing identity:", err)
+		}
+		return 1
+	}
+	fmt.Println(common.Green + "Identity written to " + common.Reset + path)
+	fmt.Println(common.Cyan + "Public key: " + common.Reset + id.Recipient())
+	return 0
+}
+
+func runRecipients(v *vault.Vault, config string, args []string) int {
+	if len(args) == 0 || args[0] == "list" {
+		recipients := v.Recipients()
+		if len(recipients) == 0 {
+			fmt.Println(common.Yellow + "This vault has no recipients, it is opened with its password only." + common.Reset)
+			return 0
+		}
+		for _, r := range recipients {
+			fmt.Println("|> " + common.Blue + r + common.Reset)
+		}
+		return 0
+	}
+
+	if len(args) < 2 {
+		fmt.Println(common.Red + "Usage: gopass recipients add|remove <public key>" + common.Reset)
+		return 1
+	}
+	switch args[0] {
+	case "add":
+		if err := v.AddRecipient(args[1], config); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Println(common.Green + "Added recipient " + common.Reset + args[1])
+	case "remove":
+		if err := v.RemoveRecipient(args[1], config); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Println(common.Green + "Removed recipient " + common.Reset + args[1] + common.Green + " and rotated the data key" + common.Reset)
+	default:
+		fmt.Println(common.Red + "Unknown recipients command, use add, remove or list." + common.Reset)
+		return 1
+	}
+	return 0
+}
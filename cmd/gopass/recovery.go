@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+func runRecoverySplit(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("recovery split", flag.ContinueOnError)
+	n := fs.Int("shares", 5, "Number of shares to create")
+	threshold := fs.Int("threshold", 3, "Number of shares needed to recover the vault")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	shares, err := v.SplitKey(config, *n, *threshold)
+	if err != nil {
+		fmt.Println("Error splitting vault key:", err)
+		return 1
+	}
+	fmt.Printf(common.Green+"Any %d of these %d shares restore access to %s:"+common.Reset+"\n\n", *threshold, *n, config)
+	for i, s := range shares {
+		fmt.Printf("%d: %s\n", i+1, s)
+	}
+	fmt.Println()
+	fmt.Println(common.Yellow + "Give each share to a different person. Removing a recipient rotates the key and invalidates these shares." + common.Reset)
+	return 0
+}
+
+// runRecoveryCombine runs before the vault is opened, since nobody may know its password anymore.
+func runRecoveryCombine(config string, args []string) int {
+	lines := args
+	if len(lines) == 0 {
+		fmt.Println(common.Blue + "Enter recovery shares, one per line, finish with an empty line:" + common.Reset)
+		for {
+			line, err := stdin.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			lines = append(lines, line)
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	var shares []vault.RecoveryShare
+	for i, line := range lines {
+		s, err := vault.ParseShare(line)
+		if err != nil {
+			fmt.Printf(common.Red+"Share %d rejected: %v"+common.Reset+"\n", i+1, err)
+			return 1
+		}
+		shares = append(shares, s)
+	}
+
+	reader := prompt{}
+	password, err := reader.Read("New vault password: ")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	confirm, err := reader.Read("Repeat new password: ")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if password != confirm {
+		fmt.Println(common.Red + "Passwords do not match." + common.Reset)
+		return 1
+	}
+
+	if _, err := vault.CombineShares(config, shares, password); err != nil {
+		fmt.Println(common.Red+"Recovery failed: "+common.Reset, err)
+		return 1
+	}
+	fmt.Println(common.Green + "Vault recovered, the new password is now set for " + common.Reset + config)
+	return 0
+}
+
+func runRecovery(v *vault.Vault, config string, args []string) int {
+	if len(args) > 0 && args[0] == "split" {
+		return runRecoverySplit(v, config, args[1:])
+	}
+	fmt.Println(common.Red + "Usage: gopass recovery split [--shares n] [--threshold k] | gopass recovery combine [share...]" + common.Reset)
+	return 1
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/kdbx"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// fileFormat returns the --format value, or guesses it from the extension.
+// An existing directory is taken for a pass tree.
+func fileFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			format = "pass-dir"
+		} else if guess, ok := envExtensions[format]; ok {
+			format = guess
+		} else if format != "csv" && format != "kdbx" && format != "1pux" {
+			format = "json"
+		}
+	}
+	switch format {
+	case "json", "csv", "kdbx", "bitwarden", "1pux", "pass-dir", vault.EnvDotenv, vault.EnvYAML, vault.EnvShell:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use json, csv, kdbx, bitwarden, 1pux, pass-dir, dotenv, yaml or shell", format)
+}
+
+// envExtensions maps file extensions to the environment variable formats.
+var envExtensions = map[string]string{
+	"env":  vault.EnvDotenv,
+	"yaml": vault.EnvYAML,
+	"yml":  vault.EnvYAML,
+	"sh":   vault.EnvShell,
+}
+
+func isEnvFormat(format string) bool {
+	return format == vault.EnvDotenv || format == vault.EnvYAML || format == vault.EnvShell
+}
+
+// readNewPassword asks for a password to protect an export with, twice.
+func readNewPassword(text string) (string, error) {
+	reader := prompt{}
+	password, err := reader.Read(text)
+	if err != nil {
+		return "", err
+	}
+	confirm, err := reader.Read("Repeat password: ")
+	if err != nil {
+		return "", err
+	}
+	if password != confirm {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// Default command for decrypting pass files, see passCommand.
+const defaultPassDecrypt = "gpg --quiet --batch --decrypt"
+
+// passCommand returns the pass decrypt or encrypt command: the flag if set,
+// else the pass_decrypt or pass_encrypt setting in ~/.gopassrc, else def.
+func passCommand(flagValue, setting, def string) []string {
+	command := flagValue
+	if command == "" {
+		command, _ = vault.GetConfigValue(setting)
+	}
+	if command == "" {
+		command = def
+	}
+	return strings.Fields(command)
+}
+
+// kdbxKey reads the key file, if any, and asks for the database password,
+// twice when creating a database. The password may be left empty if there
+// is a key file.
+func kdbxKey(keyFile string, create bool) (kdbx.Key, error) {
+	var key kdbx.Key
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return key, fmt.Errorf("failed to read key file: %v", err)
+		}
+		key.KeyFile = data
+	}
+	var password string
+	var err error
+	if create {
+		password, err = readNewPassword("KeePass database password: ")
+	} else {
+		password, err = prompt{}.Read("KeePass database password: ")
+	}
+	if err != nil {
+		return key, err
+	}
+	if password != "" {
+		key.Password = []byte(password)
+	} else if key.KeyFile == nil {
+		return key, fmt.Errorf("a password or --keyfile is required")
+	}
+	return key, nil
+}
+
+func runExport(v *vault.Vault, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatFlag := fs.String("format", "", "File format: json, csv, kdbx, pass-dir, dotenv, yaml or shell (default from the file extension)")
+	prefix := fs.String("prefix", "", "Only export entries under this prefix, as variables named after the rest (dotenv, yaml, shell)")
+	encrypt := fs.Bool("encrypt", false, "Write an encrypted gopass bundle instead")
+	var recipients stringList
+	fs.Var(&recipients, "recipient", "Public key (gopass1...) that can open the bundle, may be repeated; without one a password is asked for")
+	plaintext := fs.Bool("plaintext", false, "Allow writing secrets unencrypted to a file (json, csv, pass-dir, dotenv, yaml, shell)")
+	keyFile := fs.String("keyfile", "", "KeePass key file (kdbx)")
+	encryptCmd := fs.String("encrypt-cmd", "", "Command encrypting each pass file from stdin to stdout (pass-dir)")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) > 1 || len(pos) == 0 && !isEnvFormat(*formatFlag) {
+		fmt.Println(common.Red + "Usage: gopass export --encrypt [--recipient key]... <file> | gopass export [--format json|csv|kdbx|pass-dir] [--plaintext] [--keyfile file] [--encrypt-cmd cmd] <file> | gopass export --format dotenv|yaml|shell [--prefix prefix] [--plaintext <file>]" + common.Reset)
+		return 1
+	}
+	path := ""
+	if len(pos) == 1 {
+		path = pos[0]
+	}
+
+	if *encrypt {
+		if *formatFlag != "" || *plaintext || *prefix != "" {
+			fmt.Println(common.Red + "--encrypt writes a gopass bundle, --format, --prefix and --plaintext don't apply." + common.Reset)
+			return 1
+		}
+		password := ""
+		if len(recipients) == 0 {
+			if password, err = readNewPassword("Bundle password: "); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			if password == "" {
+				fmt.Println(common.Red + "The bundle password cannot be empty." + common.Reset)
+				return 1
+			}
+		}
+		if err := v.ExportBundle(path, password, recipients); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Println(common.Green + "Exported encrypted bundle to " + common.Reset + path)
+		return 0
+	}
+
+	format, err := fileFormat(*formatFlag, path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if isEnvFormat(format) {
+		return exportEnv(v, format, *prefix, path, *plaintext)
+	}
+	if *prefix != "" {
+		fmt.Println(common.Red + "--prefix only applies to dotenv, yaml and shell." + common.Reset)
+		return 1
+	}
+	if format == "bitwarden" || format == "1pux" {
+		fmt.Println(common.Red + "Exporting to " + format + " isn't supported, use json, csv, kdbx or pass-dir." + common.Reset)
+		return 1
+	}
+	var passEncrypt []string
+	if format == "pass-dir" && !*plaintext {
+		passEncrypt = passCommand(*encryptCmd, "pass_encrypt", "")
+	}
+	if format != "kdbx" && passEncrypt == nil && !*plaintext {
+		fmt.Println(common.Red + "Refusing to write secrets unencrypted. Use --encrypt for an encrypted bundle, or --plaintext to export " + format + " anyway." + common.Reset)
+		if format == "pass-dir" {
+			fmt.Println("Pass trees can also be encrypted with --encrypt-cmd or pass_encrypt in ~/.gopassrc (e.g. gpg --batch --encrypt --recipient you@example.com).")
+		}
+		return 1
+	}
+
+	switch format {
+	case "csv":
+		err = v.ExportCSV(path)
+	case "kdbx":
+		var key kdbx.Key
+		if key, err = kdbxKey(*keyFile, true); err == nil {
+			err = v.ExportKDBX(path, key)
+		}
+	case "pass-dir":
+		var skipped []string
+		skipped, err = v.ExportPassDir(path, passEncrypt)
+		for _, name := range skipped {
+			fmt.Println(common.Red + "Skipped " + common.Reset + name + ": the name points outside the directory")
+		}
+	default:
+		err = v.Export(path)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(common.Green + "Exported vault to " + common.Reset + path)
+	return 0
+}
+
+// exportEnv writes the entries under prefix as environment variables to
+// path, or to stdout if path is empty or "-". Stdout is meant for a redirect
+// like "> .env" and doesn't need --plaintext, so messages go to stderr.
+func exportEnv(v *vault.Vault, format, prefix, path string, plaintext bool) int {
+	if path == "" || path == "-" {
+		n, err := v.ExportEnv(os.Stdout, format, prefix)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if n == 0 {
+			fmt.Fprintln(os.Stderr, common.Yellow+"No entries under "+common.Reset+prefix)
+		}
+		return 0
+	}
+	if !plaintext {
+		fmt.Println(common.Red + "Refusing to write secrets unencrypted. Use --plaintext to export " + format + " to a file anyway, or leave out the file to print to stdout." + common.Reset)
+		return 1
+	}
+	f, err := vault.CreatePrivateFile(path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	n, err := v.ExportEnv(f, format, prefix)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf(common.Green+"Exported %d entries to "+common.Reset+"%s\n", n, path)
+	return 0
+}
+
+func runImport(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatFlag := fs.String("format", "", "File format: json, csv, kdbx, bitwarden, 1pux, pass-dir, dotenv, yaml or shell (default from the file extension)")
+	prefix := fs.String("prefix", "", "Store variables as entries under this prefix (dotenv, yaml, shell)")
+	keyFile := fs.String("keyfile", "", "KeePass key file (kdbx)")
+	decryptCmd := fs.String("decrypt-cmd", "", "Command decrypting each pass file from stdin to stdout (pass-dir, default "+defaultPassDecrypt+")")
+	plaintext := fs.Bool("plaintext", false, "Read the pass tree as a plaintext mirror (pass-dir)")
+	bundle := fs.Bool("bundle", false, "The file is an encrypted gopass bundle (detected automatically)")
+	onConflict := fs.String("on-conflict", vault.ConflictSkip, "What to do with names already in the vault: skip, rename, overwrite or ask")
+	dryRun := fs.Bool("dry-run", false, "Print what would be added, updated and skipped without changing the vault")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 1 {
+		fmt.Println(common.Red + "Usage: gopass import [--bundle | --format json|csv|kdbx|bitwarden|1pux|pass-dir|dotenv|yaml|shell] [--prefix prefix] [--keyfile file] [--decrypt-cmd cmd | --plaintext] [--on-conflict skip|rename|overwrite|ask] [--dry-run] <file>" + common.Reset)
+		return 1
+	}
+	format, err := fileFormat(*formatFlag, pos[0])
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	policy, err := vault.ParseConflict(*onConflict)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if *prefix != "" && !isEnvFormat(format) {
+		fmt.Println(common.Red + "--prefix only applies to dotenv, yaml and shell." + common.Reset)
+		return 1
+	}
+	opts := vault.ImportOptions{Policy: policy, DryRun: *dryRun}
+	if policy == vault.ConflictAsk {
+		opts.Ask = askConflict(stdin)
+	}
+	if format == "pass-dir" {
+		decrypt := passCommand(*decryptCmd, "pass_decrypt", defaultPassDecrypt)
+		if *plaintext {
+			decrypt = nil
+		}
+		report, err := v.ImportPassDir(pos[0], decrypt, config, opts)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		printImportReport(report, opts.DryRun)
+		return 0
+	}
+	data, err := os.ReadFile(pos[0])
+	if err != nil {
+		fmt.Printf("Error opening file: %v\n", pos[0])
+		return 1
+	}
+	if *bundle || vault.IsBundle(data) {
+		report, err := v.ImportBundle(data, prompt{}, config, opts)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		printImportReport(report, opts.DryRun)
+		return 0
+	}
+
+	var report *vault.ImportReport
+	switch format {
+	case "kdbx":
+		var key kdbx.Key
+		if key, err = kdbxKey(*keyFile, false); err == nil {
+			report, err = v.ImportKDBX(data, key, config, opts)
+		}
+	case "bitwarden":
+		report, err = v.ImportBitwarden(data, config, opts)
+	case "1pux":
+		report, err = v.Import1Password(data, config, opts)
+	case vault.EnvDotenv, vault.EnvYAML, vault.EnvShell:
+		report, err = v.ImportEnv(data, format, *prefix, config, opts)
+	case "csv":
+		report, err = v.ImportCSV(data, config, opts)
+	default:
+		report, err = v.Import(data, config, opts)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	printImportReport(report, opts.DryRun)
+	return 0
+}
+
+// askConflict returns an ImportOptions.Ask that asks what to do with each
+// taken name on in. An upper-case answer applies to the remaining names too.
+func askConflict(in io.Reader) func(string) (string, error) {
+	reader := bufio.NewReader(in)
+	all := ""
+	return func(name string) (string, error) {
+		if all != "" {
+			return all, nil
+		}
+		for {
+			fmt.Print(common.Yellow + name + common.Reset + " already exists: [s]kip, [o]verwrite or [r]ename? (S/O/R for all) ")
+			answer, err := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			policy := map[string]string{"s": vault.ConflictSkip, "o": vault.ConflictOverwrite, "r": vault.ConflictRename}[strings.ToLower(answer)]
+			if policy != "" {
+				if answer != strings.ToLower(answer) {
+					all = policy
+				}
+				return policy, nil
+			}
+			if err != nil {
+				fmt.Println()
+				return "", fmt.Errorf("import cancelled, nothing was changed")
+			}
+		}
+	}
+}
+
+func printImportReport(r *vault.ImportReport, dryRun bool) {
+	if dryRun {
+		printImportPlan(r)
+		return
+	}
+	for _, name := range r.Added {
+		fmt.Println(common.Green + "Added " + common.Reset + name)
+	}
+	for _, name := range r.Overwritten {
+		fmt.Println(common.Yellow + "Overwrote " + common.Reset + name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Renamed)) {
+		fmt.Println(common.Cyan + "Added " + common.Reset + r.Renamed[name] + common.Cyan + " as " + common.Reset + name)
+	}
+	for _, reason := range r.Skipped {
+		fmt.Println(common.Red + "Skipped " + common.Reset + reason)
+	}
+	for _, item := range r.Unsupported {
+		fmt.Println(common.Yellow + "Unsupported " + common.Reset + item)
+	}
+	fmt.Printf("%d added, %d overwritten, %d renamed, %d skipped", len(r.Added), len(r.Overwritten), len(r.Renamed), len(r.Skipped))
+	if len(r.Unsupported) > 0 {
+		fmt.Printf(", %d unsupported", len(r.Unsupported))
+	}
+	fmt.Println()
+}
+
+// printImportPlan prints a dry run as a diff: + for new entries, ~ for
+// updated ones, = for skipped items and ? for names --on-conflict ask
+// would ask about.
+func printImportPlan(r *vault.ImportReport) {
+	for _, name := range r.Added {
+		fmt.Println(common.Green + "+ " + name + common.Reset)
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Renamed)) {
+		fmt.Println(common.Green + "+ " + name + common.Reset + " (renamed from " + r.Renamed[name] + ")")
+	}
+	for _, name := range r.Overwritten {
+		fmt.Println(common.Yellow + "~ " + name + common.Reset)
+	}
+	for _, name := range r.Conflicts {
+		fmt.Println(common.Cyan + "? " + name + common.Reset + " (already exists, would ask)")
+	}
+	for _, reason := range r.Skipped {
+		fmt.Println("= " + reason)
+	}
+	for _, item := range r.Unsupported {
+		fmt.Println(common.Red + "! " + common.Reset + item + " (unsupported)")
+	}
+	fmt.Printf("Dry run, nothing was changed: %d to add, %d to update, %d to rename, %d to skip", len(r.Added), len(r.Overwritten), len(r.Renamed), len(r.Skipped))
+	if len(r.Conflicts) > 0 {
+		fmt.Printf(", %d to ask about", len(r.Conflicts))
+	}
+	if len(r.Unsupported) > 0 {
+		fmt.Printf(", %d unsupported", len(r.Unsupported))
+	}
+	fmt.Println()
+}
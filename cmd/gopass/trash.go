@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/prozod/gopass/internal/common"
+	"github.com/prozod/gopass/internal/vault"
+)
+
+func runRemove(v *vault.Vault, config string, args []string) int {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Delete for good instead of moving to the trash")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return 1
+	}
+	if len(pos) != 1 {
+		fmt.Println(common.Red + "Usage: gopass rm [--force] <key>" + common.Reset)
+		return 1
+	}
+	if *force {
+		err = v.Purge(pos[0], config)
+	} else {
+		err = v.Remove(pos[0], config)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if *force {
+		fmt.Println(common.Green + "Deleted " + common.Reset + pos[0] + common.Green + " from vault" + common.Reset)
+	} else {
+		fmt.Println(common.Green + "Moved " + common.Reset + pos[0] + common.Green + " to the trash" + common.Reset)
+	}
+	return 0
+}
+
+func runUndelete(v *vault.Vault, config string, args []string) int {
+	if len(args) != 1 {
+		fmt.Println(common.Red + "Usage: gopass undelete <key>" + common.Reset)
+		return 1
+	}
+	if err := v.Undelete(args[0], config); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(common.Green + "Restored " + common.Reset + args[0])
+	return 0
+}
+
+func runTrash(v *vault.Vault, config string, args []string) int {
+	if len(args) == 0 || args[0] == "list" {
+		items := v.Trash()
+		if len(items) == 0 {
+			fmt.Println(common.Green + "The trash is empty." + common.Reset)
+			return 0
+		}
+		for _, t := range items {
+			fmt.Printf("|> "+common.Blue+"%s"+common.Reset+" deleted %s\n", t.Name, t.Deleted.Format("2006-01-02 15:04"))
+		}
+		return 0
+	}
+	if args[0] != "empty" {
+		fmt.Println(common.Red + "Usage: gopass trash list | gopass trash empty [--older-than 30d]" + common.Reset)
+		return 1
+	}
+
+	fs := flag.NewFlagSet("trash empty", flag.ContinueOnError)
+	olderThan := fs.String("older-than", "", "Only delete entries removed longer ago than this (e.g. 30d)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 1
+	}
+	var age time.Duration
+	if *olderThan != "" {
+		d, err := parseDuration(*olderThan)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		age = d
+	}
+	n, err := v.EmptyTrash(age, config)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf(common.Green+"Deleted %d entries from the trash"+common.Reset+"\n", n)
+	return 0
+}
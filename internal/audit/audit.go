@@ -0,0 +1,302 @@
+// Package audit scores password strength and builds hygiene reports (weak,
+// reused and old passwords) for vault entries without revealing their values.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	_ "embed"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:embed common.txt
+var commonList string
+
+var common = func() map[string]bool {
+	words := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(commonList))
+	for scanner.Scan() {
+		if w := strings.TrimSpace(scanner.Text()); w != "" {
+			words[w] = true
+		}
+	}
+	return words
+}()
+
+const (
+	// MinEntropy is the estimated strength in bits below which a password is weak.
+	MinEntropy = 50
+	minLength  = 12
+)
+
+var (
+	keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+	yearPattern  = regexp.MustCompile(`(19|20)\d\d`)
+	leet         = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+)
+
+// Strength is the result of checking a single password.
+type Strength struct {
+	Entropy float64  `json:"entropy_bits"`
+	Issues  []string `json:"issues,omitempty"`
+}
+
+// Weak reports whether the password should be replaced.
+func (s Strength) Weak() bool {
+	return s.Entropy < MinEntropy
+}
+
+// Check estimates the entropy of a password and lists the patterns that make
+// it guessable.
+func Check(password string) Strength {
+	var s Strength
+	runes := []rune(password)
+	if len(runes) == 0 {
+		s.Issues = append(s.Issues, "empty")
+		return s
+	}
+
+	pool, classes := charsetSize(runes)
+	bits := math.Log2(float64(pool))
+	effective, longestRun := effectiveLength(runes)
+	if longestRun >= 3 {
+		s.Issues = append(s.Issues, "repeated characters or sequences")
+	}
+	s.Entropy = float64(effective) * bits
+
+	lower := strings.ToLower(password)
+	if common[lower] {
+		s.Issues = append(s.Issues, "common password")
+		s.Entropy = math.Min(s.Entropy, math.Log2(float64(len(common))))
+	} else if word := commonWord(lower); word != "" {
+		// a dictionary word with a few decorations costs the word plus the extras
+		s.Issues = append(s.Issues, "contains a common word")
+		extra := len(runes) - len(word)
+		s.Entropy = math.Min(s.Entropy, math.Log2(float64(len(common)))+float64(extra)*bits)
+	}
+
+	if k := keyboardRun(lower); k >= 4 {
+		// a run along a keyboard row is about as guessable as a single character
+		s.Issues = append(s.Issues, "keyboard pattern")
+		s.Entropy -= float64(k-1) * bits
+	}
+	if yearPattern.MatchString(password) {
+		s.Issues = append(s.Issues, "contains a year")
+		s.Entropy -= 5
+	}
+	if len(runes) < minLength {
+		s.Issues = append(s.Issues, "shorter than 12 characters")
+	}
+	if classes == 1 {
+		s.Issues = append(s.Issues, "only one kind of character")
+	}
+	s.Entropy = math.Max(0, math.Round(s.Entropy*10)/10)
+	return s
+}
+
+func charsetSize(runes []rune) (int, int) {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool, classes := 0, 0
+	for _, c := range []struct {
+		set  bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.set {
+			pool += c.size
+			classes++
+		}
+	}
+	return pool, classes
+}
+
+// effectiveLength counts characters that don't just repeat the previous one
+// or continue an ascending/descending run (aaaa, abcd, 4321), and returns the
+// longest such run.
+func effectiveLength(runes []rune) (int, int) {
+	n, run, longest := 1, 1, 1
+	for i := 1; i < len(runes); i++ {
+		d := runes[i] - runes[i-1]
+		if d == 0 || ((d == 1 || d == -1) && i > 1 && runes[i-1]-runes[i-2] == d) {
+			run++
+			longest = max(longest, run)
+			continue
+		}
+		if d == 1 || d == -1 {
+			run = 2
+		} else {
+			run = 1
+		}
+		n++
+	}
+	return n, longest
+}
+
+// commonWord returns the longest common password of four or more letters
+// hidden in s once digits and symbols around it are stripped and leetspeak
+// is undone (P@ssw0rd2024! contains "password").
+func commonWord(s string) string {
+	core := strings.TrimFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	core = leet.Replace(core)
+	best := ""
+	for w := range common {
+		if len(w) >= 4 && len(w) > len(best) && strings.Contains(core, w) && isAlpha(w) {
+			best = w
+		}
+	}
+	return best
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyboardRun returns the length of the longest stretch of s that follows a
+// keyboard row, forwards or backwards.
+func keyboardRun(s string) int {
+	longest := 0
+	for _, row := range keyboardRows {
+		reversed := []rune(row)
+		slices.Reverse(reversed)
+		for _, r := range []string{row, string(reversed)} {
+			for i := range len(r) {
+				for j := len(r); j-i > longest; j-- {
+					if strings.Contains(s, r[i:j]) {
+						longest = j - i
+						break
+					}
+				}
+			}
+		}
+	}
+	return longest
+}
+
+// Source is what an audit reads: entry names, one value at a time, and when
+// each value was last changed.
+type Source interface {
+	Names() []string
+	Value(name string) (string, error)
+	Changed(name string) time.Time
+}
+
+// Finding is the report for a single entry. It never contains the value.
+type Finding struct {
+	Name       string    `json:"name"`
+	Strength   Strength  `json:"strength"`
+	Weak       bool      `json:"weak"`
+	ReusedWith []string  `json:"reused_with,omitempty"`
+	Changed    time.Time `json:"changed,omitzero"`
+	AgeDays    int       `json:"age_days"`
+	Old        bool      `json:"old"`
+	Breached   int       `json:"breached,omitempty"` // times seen in the breach database
+	Error      string    `json:"error,omitempty"`
+}
+
+// OK reports whether the entry has no problems.
+func (f Finding) OK() bool {
+	return !f.Weak && len(f.ReusedWith) == 0 && !f.Old && f.Breached == 0 && f.Error == ""
+}
+
+// Report is the result of auditing a whole vault.
+type Report struct {
+	Entries  []Finding `json:"entries"`
+	Total    int       `json:"total"`
+	Weak     int       `json:"weak"`
+	Reused   int       `json:"reused"`
+	Old      int       `json:"old"`
+	Breached int       `json:"breached"`
+}
+
+// Options tunes an audit.
+type Options struct {
+	MaxAge   time.Duration // flag values unchanged for longer, zero disables the check
+	Now      time.Time
+	Breaches *BreachDB // optional offline breach database
+}
+
+// Run audits every entry of src. Values are decrypted one at a time; only
+// their SHA-256 digests are kept to detect reuse.
+func Run(src Source, opts Options) *Report {
+	r := &Report{}
+	byDigest := make(map[[sha256.Size]byte][]string)
+	digestOf := make(map[string][sha256.Size]byte)
+
+	for _, name := range src.Names() {
+		f := Finding{Name: name}
+		value, err := src.Value(name)
+		if err != nil {
+			f.Error = err.Error()
+			r.Entries = append(r.Entries, f)
+			continue
+		}
+		f.Strength = Check(value)
+		f.Weak = f.Strength.Weak()
+		if opts.Breaches != nil && value != "" {
+			if f.Breached, err = opts.Breaches.Count(value); err != nil {
+				f.Error = err.Error()
+			}
+		}
+		if value != "" {
+			d := sha256.Sum256([]byte(value))
+			byDigest[d] = append(byDigest[d], name)
+			digestOf[name] = d
+		}
+
+		if changed := src.Changed(name); !changed.IsZero() {
+			f.Changed = changed
+			f.AgeDays = int(opts.Now.Sub(changed).Hours() / 24)
+			f.Old = opts.MaxAge > 0 && opts.Now.Sub(changed) > opts.MaxAge
+		}
+		r.Entries = append(r.Entries, f)
+	}
+
+	for i := range r.Entries {
+		f := &r.Entries[i]
+		if d, ok := digestOf[f.Name]; ok {
+			for _, other := range byDigest[d] {
+				if other != f.Name {
+					f.ReusedWith = append(f.ReusedWith, other)
+				}
+			}
+		}
+		r.Total++
+		if f.Weak {
+			r.Weak++
+		}
+		if len(f.ReusedWith) > 0 {
+			r.Reused++
+		}
+		if f.Old {
+			r.Old++
+		}
+		if f.Breached > 0 {
+			r.Breached++
+		}
+	}
+	slices.SortStableFunc(r.Entries, func(a, b Finding) int { return strings.Compare(a.Name, b.Name) })
+	return r
+}
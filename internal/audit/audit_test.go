@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		password string
+		weak     bool
+		issue    string
+	}{
+		{"password", true, "common password"},
+		{"P@ssw0rd2024!", true, "contains a common word"},
+		{"qwertyuiop123", true, "keyboard pattern"},
+		{"aaaaaaaaaaaaaaaa", true, "repeated characters or sequences"},
+		{"abcdefghijklmnop", true, "repeated characters or sequences"},
+		{"summer1987", true, "contains a year"},
+		{"x7#Kp2!vQm9$Lw4z", false, ""},
+		{"correct-horse-battery-staple-glue", false, ""},
+	}
+	for _, c := range cases {
+		s := Check(c.password)
+		if s.Weak() != c.weak {
+			t.Errorf("Check(%q) weak = %v (%.1f bits, %v), want %v", c.password, s.Weak(), s.Entropy, s.Issues, c.weak)
+		}
+		if c.issue != "" && !slices.Contains(s.Issues, c.issue) {
+			t.Errorf("Check(%q) issues = %v, want %q", c.password, s.Issues, c.issue)
+		}
+	}
+}
+
+type fakeSource struct {
+	values  map[string]string
+	changed map[string]time.Time
+}
+
+func (f fakeSource) Names() []string {
+	var names []string
+	for n := range f.values {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (f fakeSource) Value(name string) (string, error) {
+	if name == "broken" {
+		return "", errors.New("cannot decrypt")
+	}
+	return f.values[name], nil
+}
+
+func (f fakeSource) Changed(name string) time.Time { return f.changed[name] }
+
+func TestRun(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := fakeSource{
+		values: map[string]string{
+			"a":      "x7#Kp2!vQm9$Lw4z",
+			"b":      "x7#Kp2!vQm9$Lw4z",
+			"c":      "letmein",
+			"d":      "Zr8!tq#2Vn$e5Lp^",
+			"broken": "",
+		},
+		changed: map[string]time.Time{"d": at.AddDate(0, 0, -730), "a": at.AddDate(0, -1, 0)},
+	}
+	r := Run(src, Options{MaxAge: 365 * 24 * time.Hour, Now: at})
+	if r.Total != 5 || r.Weak != 1 || r.Reused != 2 || r.Old != 1 {
+		t.Fatalf("unexpected summary: %+v", r)
+	}
+	byName := map[string]Finding{}
+	for _, f := range r.Entries {
+		byName[f.Name] = f
+	}
+	if got := byName["a"].ReusedWith; !slices.Equal(got, []string{"b"}) {
+		t.Errorf("a reused with %v, want [b]", got)
+	}
+	if !byName["c"].Weak || !byName["d"].Old || byName["d"].AgeDays != 730 {
+		t.Errorf("unexpected findings: %+v %+v", byName["c"], byName["d"])
+	}
+	if byName["broken"].Error == "" || byName["broken"].OK() {
+		t.Errorf("decryption error not reported: %+v", byName["broken"])
+	}
+	if !byName["d"].Weak && byName["d"].OK() {
+		t.Errorf("old entry reported ok")
+	}
+}
@@ -0,0 +1,195 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+A BreachDB answers "how often was this password seen in a breach" from a local
+mirror of the Have I Been Pwned SHA-1 dataset, in one of two layouts:
+
+	sorted file:  one "HASH:COUNT" line per password, sorted by hash, as in
+	              pwned-passwords-sha1-ordered-by-hash.txt
+	range dir:    one file per 5-hex-digit prefix (00000, 00001.txt, ...)
+	              holding "SUFFIX:COUNT" lines, as served by the range API
+
+The sorted file is binary searched with seeks and the range files are read
+line by line, so memory use doesn't grow with the size of the dataset.
+*/
+
+// lineProbe is how many bytes the binary search reads at each step, enough
+// for any line of the dataset.
+const lineProbe = 128
+
+// BreachDB looks passwords up in a local HIBP dataset.
+type BreachDB struct {
+	dir  string
+	file *os.File
+	size int64
+}
+
+// OpenBreachDB opens a sorted hash file or a directory of range files.
+func OpenBreachDB(path string) (*BreachDB, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open breach database: %v", err)
+	}
+	if info.IsDir() {
+		return &BreachDB{dir: path}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open breach database: %v", err)
+	}
+	return &BreachDB{file: f, size: info.Size()}, nil
+}
+
+// Close releases the underlying file.
+func (b *BreachDB) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Close()
+}
+
+// Count returns how many times the password appears in the dataset, 0 if
+// it doesn't.
+func (b *BreachDB) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if b.dir != "" {
+		return b.countInRange(hash)
+	}
+	return b.countInFile(hash)
+}
+
+func (b *BreachDB) countInRange(hash string) (int, error) {
+	prefix, suffix := hash[:5], hash[5:]
+	var f *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		if f, err = os.Open(filepath.Join(b.dir, name)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("breach database has no range file for %s", prefix)
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h, count, ok := parseHashLine(scanner.Bytes())
+		if ok && strings.EqualFold(h, suffix) {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+func (b *BreachDB) countInFile(hash string) (int, error) {
+	// invariant: if hash is in the file, its line starts in [lo, hi)
+	// and lo is always the start of a line
+	lo, hi := int64(0), b.size
+	for hi-lo > 4*lineProbe {
+		mid := lo + (hi-lo)/2
+		line, start, err := b.lineAfter(mid)
+		if err != nil {
+			return 0, err
+		}
+		if line == nil {
+			hi = mid
+			continue
+		}
+		h, count, ok := parseHashLine(line)
+		if !ok {
+			return 0, fmt.Errorf("breach database has a malformed line at offset %d", start)
+		}
+		switch c := strings.Compare(strings.ToUpper(h), hash); {
+		case c == 0:
+			return count, nil
+		case c < 0:
+			lo = start
+		default:
+			hi = mid
+		}
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(b.file, lo, b.size-lo))
+	for pos := lo; pos < hi; {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 {
+			pos += int64(len(line))
+			if h, count, ok := parseHashLine(line); ok {
+				switch c := strings.Compare(strings.ToUpper(h), hash); {
+				case c == 0:
+					return count, nil
+				case c > 0:
+					return 0, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// lineAfter returns the first complete line starting at or after off, and
+// its offset. line is nil at the end of the file.
+func (b *BreachDB) lineAfter(off int64) ([]byte, int64, error) {
+	start := off
+	if off > 0 {
+		start = off - 1 // a line starts at off if the byte before it is a newline
+	}
+	buf := make([]byte, 2*lineProbe)
+	n, err := b.file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	buf = buf[:n]
+	if off > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return nil, 0, nil
+		}
+		buf, start = buf[i+1:], start+int64(i)+1
+	}
+	if len(buf) == 0 {
+		return nil, 0, nil
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return buf, start, nil
+}
+
+// parseHashLine splits a "HASH:COUNT" line.
+func parseHashLine(line []byte) (string, int, bool) {
+	h, c, ok := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	if !ok {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(string(c))
+	if err != nil {
+		return "", 0, false
+	}
+	return string(h), count, true
+}
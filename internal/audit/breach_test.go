@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// breachedPasswords maps passwords to their breach counts in the test datasets.
+var breachedPasswords = map[string]int{"password": 9545824, "letmein": 3, "hunter2": 17}
+
+func writeSortedDB(t *testing.T, eol string) string {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	var lines []string
+	for i := range 5000 {
+		b := make([]byte, 20)
+		for j := range b {
+			b[j] = byte(rng.IntN(256))
+		}
+		lines = append(lines, fmt.Sprintf("%X:%d", b, i+1))
+	}
+	for p, n := range breachedPasswords {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(p), n))
+	}
+	slices.Sort(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, eol)+eol), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkCounts(t *testing.T, db *BreachDB) {
+	t.Helper()
+	for p, want := range breachedPasswords {
+		if got, err := db.Count(p); err != nil || got != want {
+			t.Errorf("Count(%q) = %d, %v, want %d", p, got, err, want)
+		}
+	}
+	for _, p := range []string{"x7#Kp2!vQm9$Lw4z", "", "not-breached"} {
+		if got, err := db.Count(p); err != nil || got != 0 {
+			t.Errorf("Count(%q) = %d, %v, want 0", p, got, err)
+		}
+	}
+}
+
+func TestBreachDB_SortedFile(t *testing.T) {
+	for _, eol := range []string{"\n", "\r\n"} {
+		db, err := OpenBreachDB(writeSortedDB(t, eol))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkCounts(t, db)
+		db.Close()
+	}
+}
+
+func TestBreachDB_RangeDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"x7#Kp2!vQm9$Lw4z", "", "not-breached"} {
+		// range files exist for every prefix, most without a match
+		h := sha1Hex(p)
+		if err := os.WriteFile(filepath.Join(dir, h[:5]+".txt"), []byte("0000000000000000000000000000000000A:1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p, n := range breachedPasswords {
+		h := sha1Hex(p)
+		content := fmt.Sprintf("0000000000000000000000000000000000A:1\r\n%s:%d\r\n", h[5:], n)
+		if err := os.WriteFile(filepath.Join(dir, h[:5]), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := OpenBreachDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkCounts(t, db)
+
+	if _, err := db.Count("no range file for this one"); err == nil {
+		t.Error("expected an error for a missing range file")
+	}
+}
+
+func TestRun_Breaches(t *testing.T) {
+	db, err := OpenBreachDB(writeSortedDB(t, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	src := fakeSource{values: map[string]string{"a": "hunter2", "b": "x7#Kp2!vQm9$Lw4z"}}
+	r := Run(src, Options{Breaches: db})
+	if r.Breached != 1 || r.Entries[0].Breached != 17 || r.Entries[1].Breached != 0 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+}
@@ -20,12 +20,32 @@ func PrintHelp() {
 	fmt.Println()
 	fmt.Printf(Bold + `Usage:` + Reset + "\n")
 	fmt.Println(`  ` + Green + `gopass add <name> <password>` + Reset + ` — Add a new secret`)
+	fmt.Println(`  ` + Red + `gopass rm [--force] <name>` + Reset + ` — Move a secret to the trash ('--force' deletes it for good)`)
+	fmt.Println(`  ` + Green + `gopass undelete <name>` + Reset + ` — Restore the most recently removed secret with that name`)
+	fmt.Println(`  ` + Yellow + `gopass trash list | empty [--older-than 30d]` + Reset + ` — Show or empty the trash`)
 	fmt.Println(`  ` + Blue + `gopass get <name>` + Reset + ` — Retrieve a password, copied to clipboard automatically.`)
+	fmt.Println(`  ` + Green + `gopass attach <name> <file>` + Reset + ` — Store a file (SSH key, certificate...) encrypted with an entry`)
+	fmt.Println(`  ` + Blue + `gopass attachments <name>` + Reset + ` — List the attachments of an entry`)
+	fmt.Println(`  ` + Cyan + `gopass extract <name> <attachment> -o <path>` + Reset + ` — Write an attachment to a file (mode 0600)`)
+	fmt.Println(`  ` + Yellow + `gopass expire <name> --on YYYY-MM-DD | --in 90d | --rotate 90d | --clear` + Reset + ` — Set when an entry expires or must be rotated`)
+	fmt.Println(`  ` + Red + `gopass expiring --within 30d` + Reset + ` — List entries due soon (exit code 2 if any)`)
+	fmt.Println(`  ` + Blue + `gopass log [--entry <name>] | gopass log verify` + Reset + ` — Show the encrypted audit log or check it wasn't tampered with`)
+	fmt.Println(`  ` + Cyan + `gopass audit [-json] [-max-age 365d] [-breach-db path]` + Reset + ` — Report weak, reused, old and breached passwords without showing them`)
+	fmt.Println(`  ` + Purple + `gopass otp [-copy] <name>` + Reset + ` — Print (or copy) the current TOTP code of an entry`)
+	fmt.Println(`  ` + Purple + `gopass otp -set <otpauth uri> <name>` + Reset + ` — Store a TOTP seed (otpauth:// URI) on an entry`)
 	fmt.Println(`  ` + Yellow + `gopass list` + Reset + ` — List all stored secret names (use flag '-expose' to display secrets)`)
-	fmt.Println(`  ` + Purple + `gopass export <filename> (ex: mydata.json)` + Reset + ` — Export secrets to JSON`)
-	fmt.Println(`  ` + Red + `gopass import <filepath> (ex: mydata.json)` + Reset + ` — Import secrets from JSON`)
+	fmt.Println(`  ` + Cyan + `gopass find <text>` + Reset + ` — List entry names containing text, without decrypting any secret`)
+	fmt.Println(`  ` + Purple + `gopass export --encrypt [--recipient key]... <filename>` + Reset + ` — Export an encrypted bundle to move the vault to another machine`)
+	fmt.Println(`  ` + Purple + `gopass export [--format json|csv|kdbx|pass-dir] [--plaintext] [--keyfile file] [--encrypt-cmd cmd] <filename> (ex: mydata.json)` + Reset + ` — Export secrets to JSON, browser CSV, KeePass or a pass tree`)
+	fmt.Println(`  ` + Green + `gopass export --format dotenv|yaml|shell [--prefix dev/myapp/] [--plaintext <filename>]` + Reset + ` — Print (or write) entries under a prefix as environment variables`)
+	fmt.Println(`  ` + Red + `gopass import [--bundle | --format json|csv|kdbx|bitwarden|1pux|pass-dir|dotenv|yaml|shell] [--prefix prefix] [--keyfile file] [--decrypt-cmd cmd | --plaintext] [--on-conflict skip|rename|overwrite|ask] [--dry-run] <filepath>` + Reset + ` — Import secrets from JSON, browser CSV, KeePass, Bitwarden, 1Password, a pass tree or environment variables`)
 	fmt.Println(`  ` + Cyan + `gopass -config <absolute filepath> (ex: ~/myvault.dat)` + Reset + ` — Import secrets from JSON`)
 	fmt.Println(`  ` + Yellow + `gopass vault` + Reset + ` — Display current loaded vault`)
+	fmt.Println(`  ` + Red + `gopass fsck [--yes]` + Reset + ` — Diagnose a vault file that won't open and restore it from the newest valid backup`)
+	fmt.Println(`  ` + Green + `gopass keygen [-o path]` + Reset + ` — Create an X25519 identity for shared vaults (~/.gopass_identity)`)
+	fmt.Println(`  ` + Blue + `gopass recipients list|add|remove <public key>` + Reset + ` — Manage who can open the vault, removing rotates the data key`)
+	fmt.Println(`  ` + Purple + `gopass recovery split --shares 5 --threshold 3` + Reset + ` — Split the vault key into recovery shares`)
+	fmt.Println(`  ` + Red + `gopass recovery combine [share...]` + Reset + ` — Rebuild access from enough shares and set a new password`)
 	fmt.Println()
 	fmt.Println(Bold + `Current vault is cached and saved in a local config file (~/.gopassrc).` + Reset)
 }
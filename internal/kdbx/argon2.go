@@ -0,0 +1,268 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+/*
+Argon2 as specified in RFC 9106. golang.org/x/crypto/argon2 only offers
+Argon2i and Argon2id without a secret or associated data, while KeePass
+databases are usually protected with Argon2d and may set both, so the
+algorithm is implemented here. Lanes are processed one after the other,
+which gives the same result as running them in parallel.
+*/
+
+const (
+	argon2d  = 0
+	argon2i  = 1
+	argon2id = 2
+
+	argon2Version = 0x13
+	blockWords    = 128 // a 1 KiB block as 64-bit words
+	syncPoints    = 4
+)
+
+type block [blockWords]uint64
+
+// argon2Key derives keyLen bytes. memory is in KiB.
+func argon2Key(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 || threads < 1 {
+		panic("argon2: time and threads must be at least 1")
+	}
+	h0 := argon2InitHash(password, salt, secret, data, time, memory, uint32(threads), keyLen, mode)
+
+	memory = memory / (syncPoints * uint32(threads)) * (syncPoints * uint32(threads))
+	if memory < 2*syncPoints*uint32(threads) {
+		memory = 2 * syncPoints * uint32(threads)
+	}
+	b := argon2InitBlocks(&h0, memory, uint32(threads))
+	argon2Process(b, time, memory, uint32(threads), mode)
+	return argon2Extract(b, memory, uint32(threads), keyLen)
+}
+
+func argon2InitHash(password, salt, secret, data []byte, time, memory, threads, keyLen uint32, mode int) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	b2, _ := blake2b.New512(nil)
+	var params [24]byte
+	binary.LittleEndian.PutUint32(params[0:], threads)
+	binary.LittleEndian.PutUint32(params[4:], keyLen)
+	binary.LittleEndian.PutUint32(params[8:], memory)
+	binary.LittleEndian.PutUint32(params[12:], time)
+	binary.LittleEndian.PutUint32(params[16:], argon2Version)
+	binary.LittleEndian.PutUint32(params[20:], uint32(mode))
+	b2.Write(params[:])
+	for _, in := range [][]byte{password, salt, secret, data} {
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(in)))
+		b2.Write(n[:])
+		b2.Write(in)
+	}
+	b2.Sum(h0[:0])
+	return h0
+}
+
+func argon2InitBlocks(h0 *[blake2b.Size + 8]byte, memory, threads uint32) []block {
+	var buf [1024]byte
+	b := make([]block, memory)
+	for lane := uint32(0); lane < threads; lane++ {
+		j := lane * (memory / threads)
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			blake2bLong(buf[:], h0[:])
+			for w := range b[j+i] {
+				b[j+i][w] = binary.LittleEndian.Uint64(buf[w*8:])
+			}
+		}
+	}
+	return b
+}
+
+func argon2Process(b []block, time, memory, threads uint32, mode int) {
+	lanes := memory / threads
+	segments := lanes / syncPoints
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			for lane := uint32(0); lane < threads; lane++ {
+				argon2Segment(b, n, slice, lane, lanes, segments, time, memory, threads, mode)
+			}
+		}
+	}
+}
+
+func argon2Segment(b []block, n, slice, lane, lanes, segments, time, memory, threads uint32, mode int) {
+	var addresses, in, zero block
+	independent := mode == argon2i || (mode == argon2id && n == 0 && slice < syncPoints/2)
+	if independent {
+		in[0] = uint64(n)
+		in[1] = uint64(lane)
+		in[2] = uint64(slice)
+		in[3] = uint64(memory)
+		in[4] = uint64(time)
+		in[5] = uint64(mode)
+	}
+
+	index := uint32(0)
+	if n == 0 && slice == 0 {
+		index = 2 // the first two blocks of each lane come from H0
+		if independent {
+			in[6]++
+			compress(&addresses, &in, &zero, false)
+			compress(&addresses, &addresses, &zero, false)
+		}
+	}
+
+	offset := lane*lanes + slice*segments + index
+	for index < segments {
+		prev := offset - 1
+		if index == 0 && slice == 0 {
+			prev += lanes // wrap to the last block of the lane
+		}
+		var random uint64
+		if independent {
+			if index%blockWords == 0 {
+				in[6]++
+				compress(&addresses, &in, &zero, false)
+				compress(&addresses, &addresses, &zero, false)
+			}
+			random = addresses[index%blockWords]
+		} else {
+			random = b[prev][0]
+		}
+		ref := referenceIndex(random, lanes, segments, threads, n, slice, lane, index)
+		compress(&b[offset], &b[prev], &b[ref], true)
+		index, offset = index+1, offset+1
+	}
+}
+
+// referenceIndex maps a pseudo-random value to the block to mix in (RFC 9106 section 3.4.1.2).
+func referenceIndex(random uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	area, start := 3*segments, ((slice+1)%syncPoints)*segments
+	if lane == refLane {
+		area += index
+	}
+	if n == 0 {
+		area, start = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+
+	x := random & 0xFFFFFFFF
+	x = (x * x) >> 32
+	y := (x * uint64(area)) >> 32
+	return refLane*lanes + uint32((uint64(start)+uint64(area)-(y+1))%uint64(lanes))
+}
+
+func argon2Extract(b []block, memory, threads, keyLen uint32) []byte {
+	lanes := memory / threads
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, w := range b[lane*lanes+lanes-1] {
+			b[memory-1][i] ^= w
+		}
+	}
+	var buf [1024]byte
+	for i, w := range b[memory-1] {
+		binary.LittleEndian.PutUint64(buf[i*8:], w)
+	}
+	key := make([]byte, keyLen)
+	blake2bLong(key, buf[:])
+	return key
+}
+
+// blake2bLong is the variable-length hash H' of RFC 9106 section 3.3.
+func blake2bLong(out, in []byte) {
+	var b2 hash.Hash
+	if n := len(out); n < blake2b.Size {
+		b2, _ = blake2b.New(n, nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+	var buf [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(out)))
+	b2.Write(buf[:4])
+	b2.Write(in)
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	b2.Sum(buf[:0])
+	b2.Reset()
+	copy(out, buf[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Write(buf[:])
+		b2.Sum(buf[:0])
+		copy(out, buf[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+	if outLen%blake2b.Size > 0 {
+		r := ((outLen + 31) / 32) - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buf[:])
+	b2.Sum(out[:0])
+}
+
+// compress is the compression function G. With xor set the result is
+// XORed into out, as version 1.3 does for every pass.
+func compress(out, in1, in2 *block, xor bool) {
+	var t block
+	for i := range t {
+		t[i] = in1[i] ^ in2[i]
+	}
+	for i := 0; i < blockWords; i += 16 {
+		blamka(&t[i], &t[i+1], &t[i+2], &t[i+3], &t[i+4], &t[i+5], &t[i+6], &t[i+7],
+			&t[i+8], &t[i+9], &t[i+10], &t[i+11], &t[i+12], &t[i+13], &t[i+14], &t[i+15])
+	}
+	for i := 0; i < blockWords/8; i += 2 {
+		blamka(&t[i], &t[i+1], &t[16+i], &t[16+i+1], &t[32+i], &t[32+i+1], &t[48+i], &t[48+i+1],
+			&t[64+i], &t[64+i+1], &t[80+i], &t[80+i+1], &t[96+i], &t[96+i+1], &t[112+i], &t[112+i+1])
+	}
+	for i := range out {
+		r := in1[i] ^ in2[i] ^ t[i]
+		if xor {
+			out[i] ^= r
+		} else {
+			out[i] = r
+		}
+	}
+}
+
+// mix is BLAKE2b's G with the multiplication Argon2 adds to each addition.
+func mix(a, b, c, d *uint64) {
+	*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d = bits.RotateLeft64(*d^*a, -32)
+	*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b = bits.RotateLeft64(*b^*c, -24)
+	*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d = bits.RotateLeft64(*d^*a, -16)
+	*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b = bits.RotateLeft64(*b^*c, -63)
+}
+
+// blamka is the permutation P over sixteen words: columns, then diagonals.
+func blamka(t00, t01, t02, t03, t04, t05, t06, t07, t08, t09, t10, t11, t12, t13, t14, t15 *uint64) {
+	mix(t00, t04, t08, t12)
+	mix(t01, t05, t09, t13)
+	mix(t02, t06, t10, t14)
+	mix(t03, t07, t11, t15)
+	mix(t00, t05, t10, t15)
+	mix(t01, t06, t11, t12)
+	mix(t02, t07, t08, t13)
+	mix(t03, t04, t09, t14)
+}
@@ -0,0 +1,40 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2RFC9106(t *testing.T) {
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+	cases := []struct {
+		mode int
+		tag  string
+	}{
+		{argon2d, "512b391b6f1162975371d3091973429" + "4f868e3be3984f3c1a13a4db9fabe4acb"},
+		{argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1" + "c8de6b016dd388d29952a4c4672b6ce8"},
+		{argon2id, "0d640df58d78766c08c037a34a8b53c9" + "d01ef0452d75b65eb52520e96b01e659"},
+	}
+	for _, c := range cases {
+		got := hex.EncodeToString(argon2Key(c.mode, password, salt, secret, data, 3, 32, 4, 32))
+		if got != c.tag {
+			t.Errorf("mode %d: got %s, want %s", c.mode, got, c.tag)
+		}
+	}
+}
+
+func TestArgon2MatchesXCrypto(t *testing.T) {
+	password, salt := []byte("password"), []byte("somesaltsomesalt")
+	if got, want := argon2Key(argon2id, password, salt, nil, nil, 2, 256, 2, 40), argon2.IDKey(password, salt, 2, 256, 2, 40); !bytes.Equal(got, want) {
+		t.Errorf("argon2id: got %x, want %x", got, want)
+	}
+	if got, want := argon2Key(argon2i, password, salt, nil, nil, 3, 64, 1, 100), argon2.Key(password, salt, 3, 64, 1, 100); !bytes.Equal(got, want) {
+		t.Errorf("argon2i: got %x, want %x", got, want)
+	}
+}
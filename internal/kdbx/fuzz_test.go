@@ -0,0 +1,80 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var fuzzKey = Key{Password: []byte("correct horse battery staple")}
+
+var fuzzDB = &Database{Entries: []Entry{
+	{Title: "mail", Group: []string{"Web"}, Fields: map[string]string{FieldUserName: "me", FieldPassword: "pw", "pin": "1234"}},
+	{Title: "server", Fields: map[string]string{FieldPassword: "root"}, Files: map[string][]byte{"id_ed25519": []byte("key")}},
+}}
+
+// cheapKDF makes Encode fast enough to build seeds. Decode takes whatever
+// the file says within its limits.
+func cheapKDF(f *testing.F) {
+	old := ExportKDF
+	f.Cleanup(func() { ExportKDF = old })
+	ExportKDF = Argon2Params{Memory: 8 << 10, Iterations: 1, Parallelism: 1}
+}
+
+func FuzzDecode(f *testing.F) {
+	cheapKDF(f)
+	data, err := Encode(fuzzDB, fuzzKey)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	fixtures, _ := filepath.Glob("testdata/*.kdbx")
+	for _, name := range fixtures {
+		if data, err := os.ReadFile(name); err == nil {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Decode(data, fuzzKey)
+	})
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	streamKey := bytes.Repeat([]byte{7}, 64)
+	for _, id := range []uint32{streamChaCha20, streamSalsa20} {
+		stream, err := newInnerStream(id, streamKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		doc, binaries, err := buildXML(fuzzDB, stream)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var payload bytes.Buffer
+		writeField(&payload, innerStreamID, binary.LittleEndian.AppendUint32(nil, id))
+		writeField(&payload, innerStreamKey, streamKey)
+		for _, b := range binaries {
+			writeField(&payload, innerBinary, append([]byte{1}, b...))
+		}
+		writeField(&payload, innerEnd, nil)
+		payload.Write(doc)
+		f.Add(payload.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		_, _ = decodePayload(payload)
+	})
+}
+
+func FuzzKeyFile(f *testing.F) {
+	for _, name := range []string{"testdata/keyfile.hex", "testdata/keyfile.keyx"} {
+		if data, err := os.ReadFile(name); err == nil {
+			f.Add(data)
+		}
+	}
+	f.Add([]byte("any file at all can be a key file"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = keyFileKey(data)
+	})
+}
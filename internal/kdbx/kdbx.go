@@ -0,0 +1,499 @@
+// Package kdbx reads and writes KeePass 2 databases in the KDBX 4 format:
+// AES-256 or ChaCha20 encryption, Argon2 or AES-KDF key derivation, a
+// password and/or a key file.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+/*
+Layout of a KDBX 4 file:
+
+	signature (8) | version (4) | header fields | SHA-256(header) | HMAC(header) | HMAC block stream
+
+Header fields are id (1) | length (4, LE) | data, ending with id 0. The block
+stream holds the encrypted, usually gzip-compressed payload: an inner header
+(inner stream cipher key, attachments) followed by the XML document.
+
+	composite key  = SHA-256(SHA-256(password) | key file key)
+	transformed    = KDF(composite key)
+	encryption key = SHA-256(master seed | transformed)
+	HMAC base key  = SHA-512(master seed | transformed | 0x01)
+*/
+
+const (
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB67
+	version4   = 4
+
+	hdrEnd          = 0
+	hdrCipherID     = 2
+	hdrCompression  = 3
+	hdrMasterSeed   = 4
+	hdrEncryptionIV = 7
+	hdrKdfParams    = 11
+	hdrCustomData   = 12
+
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+	innerBinary    = 3
+
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+
+	blockSize = 1 << 20
+
+	// limits that keep a hostile file from exhausting memory or time
+	maxHeaderField  = 1 << 20
+	maxPayload      = 256 << 20
+	maxArgon2Memory = 1 << 30
+	maxArgon2Lanes  = 64
+	maxArgon2Work   = 16 << 30 // memory times iterations, 1 GiB 16 times over
+	maxAESRounds    = 1 << 30
+)
+
+var (
+	cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	cipherTwofish  = []byte{0xad, 0x68, 0xf2, 0x9f, 0x57, 0x6f, 0x4b, 0xb9, 0xa3, 0x6a, 0xd4, 0x7a, 0xf9, 0x65, 0x34, 0x6c}
+
+	kdfAES      = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// ErrInvalidKey reports a wrong password or key file.
+var ErrInvalidKey = errors.New("wrong password or key file")
+
+// Key is what opens a database. Either part may be missing, but not both.
+type Key struct {
+	Password []byte // nil if the database has no password
+	KeyFile  []byte // contents of the key file, nil if there is none
+}
+
+func (k Key) composite() ([]byte, error) {
+	if k.Password == nil && k.KeyFile == nil {
+		return nil, errors.New("a password or a key file is required")
+	}
+	h := sha256.New()
+	if k.Password != nil {
+		p := sha256.Sum256(k.Password)
+		h.Write(p[:])
+	}
+	if k.KeyFile != nil {
+		kf, err := keyFileKey(k.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(kf)
+	}
+	return h.Sum(nil), nil
+}
+
+// Argon2Params are the key derivation settings used by Encode.
+type Argon2Params struct {
+	Memory      uint64 // bytes
+	Iterations  uint64
+	Parallelism uint32
+}
+
+// ExportKDF is the Argon2id cost Encode writes: KeePassXC's default memory,
+// with about a second of work for each unlock.
+var ExportKDF = Argon2Params{Memory: 64 << 20, Iterations: 8, Parallelism: 2}
+
+type outerHeader struct {
+	cipherID    []byte
+	compression uint32
+	masterSeed  []byte
+	iv          []byte
+	kdf         variantDict
+}
+
+// Decode decrypts a KDBX 4 database and returns its entries.
+func Decode(data []byte, key Key) (*Database, error) {
+	r := bytes.NewReader(data)
+	var sig [3]uint32
+	if err := binary.Read(r, binary.LittleEndian, &sig); err != nil || sig[0] != signature1 || sig[1] != signature2 {
+		return nil, errors.New("not a KeePass database")
+	}
+	if major := sig[2] >> 16; major != version4 {
+		return nil, fmt.Errorf("KDBX %d databases are not supported, save it as KDBX 4 in KeePass or KeePassXC first", major)
+	}
+
+	h, err := readOuterHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(data) - r.Len()
+	var hash, mac [32]byte
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return nil, errors.New("database is truncated")
+	}
+	if _, err := io.ReadFull(r, mac[:]); err != nil {
+		return nil, errors.New("database is truncated")
+	}
+	if sum := sha256.Sum256(data[:headerLen]); !hmac.Equal(sum[:], hash[:]) {
+		return nil, errors.New("database header is corrupted")
+	}
+
+	composite, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := transformKey(composite, h.kdf)
+	if err != nil {
+		return nil, err
+	}
+	hmacBase := sha512.Sum512(append(append(append([]byte{}, h.masterSeed...), transformed...), 1))
+	if !hmac.Equal(headerMAC(hmacBase[:], data[:headerLen]), mac[:]) {
+		return nil, ErrInvalidKey
+	}
+
+	ciphertext, err := readBlocks(r, hmacBase[:])
+	if err != nil {
+		return nil, err
+	}
+	encKey := sha256.Sum256(append(append([]byte{}, h.masterSeed...), transformed...))
+	payload, err := decrypt(h.cipherID, encKey[:], h.iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if h.compression == 1 {
+		if payload, err = gunzip(payload); err != nil {
+			return nil, err
+		}
+	} else if h.compression != 0 {
+		return nil, fmt.Errorf("unknown compression %d", h.compression)
+	}
+	return decodePayload(payload)
+}
+
+func readOuterHeader(r *bytes.Reader) (*outerHeader, error) {
+	h := &outerHeader{}
+	for {
+		id, field, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case hdrEnd:
+			if h.cipherID == nil || h.masterSeed == nil || h.iv == nil || h.kdf == nil {
+				return nil, errors.New("database header is missing required fields")
+			}
+			if len(h.masterSeed) != 32 {
+				return nil, errors.New("database header has an invalid master seed")
+			}
+			return h, nil
+		case hdrCipherID:
+			h.cipherID = field
+		case hdrCompression:
+			if len(field) != 4 {
+				return nil, errors.New("database header has an invalid compression field")
+			}
+			h.compression = binary.LittleEndian.Uint32(field)
+		case hdrMasterSeed:
+			h.masterSeed = field
+		case hdrEncryptionIV:
+			h.iv = field
+		case hdrKdfParams:
+			if h.kdf, err = parseVariantDict(field); err != nil {
+				return nil, fmt.Errorf("invalid key derivation parameters: %v", err)
+			}
+		}
+	}
+}
+
+func readField(r *bytes.Reader) (byte, []byte, error) {
+	id, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, errors.New("database header is truncated")
+	}
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return 0, nil, errors.New("database header is truncated")
+	}
+	if n > maxHeaderField || int(n) > r.Len() {
+		return 0, nil, errors.New("database header is truncated or corrupted")
+	}
+	field := make([]byte, n)
+	_, _ = io.ReadFull(r, field)
+	return id, field, nil
+}
+
+func writeField(w *bytes.Buffer, id byte, data []byte) {
+	w.WriteByte(id)
+	_ = binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+}
+
+// transformKey runs the database's key derivation over the composite key.
+func transformKey(composite []byte, kdf variantDict) ([]byte, error) {
+	uuid, _ := kdf["$UUID"].([]byte)
+	salt, _ := kdf["S"].([]byte)
+	switch {
+	case bytes.Equal(uuid, kdfArgon2d), bytes.Equal(uuid, kdfArgon2id):
+		memory, _ := kdf["M"].(uint64)
+		iterations, _ := kdf["I"].(uint64)
+		lanes, _ := kdf["P"].(uint32)
+		version, _ := kdf["V"].(uint32)
+		secret, _ := kdf["K"].([]byte)
+		ad, _ := kdf["A"].([]byte)
+		if version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version %#x", version)
+		}
+		if salt == nil || memory < 8<<10 || memory > maxArgon2Memory || iterations < 1 || iterations > maxArgon2Work/memory || lanes < 1 || lanes > maxArgon2Lanes {
+			return nil, errors.New("invalid Argon2 parameters")
+		}
+		mode := argon2d
+		if bytes.Equal(uuid, kdfArgon2id) {
+			mode = argon2id
+		}
+		return argon2Key(mode, composite, salt, secret, ad, uint32(iterations), uint32(memory/1024), uint8(lanes), 32), nil
+	case bytes.Equal(uuid, kdfAES):
+		rounds, _ := kdf["R"].(uint64)
+		if len(salt) != 32 || rounds > maxAESRounds {
+			return nil, errors.New("invalid AES-KDF parameters")
+		}
+		block, _ := aes.NewCipher(salt)
+		key := append([]byte{}, composite...)
+		for range rounds {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unsupported key derivation function %x", uuid)
+}
+
+func blockKey(hmacBase []byte, index uint64) []byte {
+	var i [8]byte
+	binary.LittleEndian.PutUint64(i[:], index)
+	sum := sha512.Sum512(append(i[:], hmacBase...))
+	return sum[:]
+}
+
+func headerMAC(hmacBase, header []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(hmacBase, ^uint64(0)))
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+func blockMAC(hmacBase []byte, index uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(hmacBase, index))
+	_ = binary.Write(mac, binary.LittleEndian, index)
+	_ = binary.Write(mac, binary.LittleEndian, uint32(len(data)))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks verifies and joins the HMAC block stream.
+func readBlocks(r *bytes.Reader, hmacBase []byte) ([]byte, error) {
+	var out []byte
+	for index := uint64(0); ; index++ {
+		var mac [32]byte
+		var n uint32
+		if _, err := io.ReadFull(r, mac[:]); err != nil {
+			return nil, errors.New("database is truncated")
+		}
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, errors.New("database is truncated")
+		}
+		if int(n) > r.Len() || len(out)+int(n) > maxPayload {
+			return nil, errors.New("database is truncated or corrupted")
+		}
+		data := make([]byte, n)
+		_, _ = io.ReadFull(r, data)
+		if !hmac.Equal(blockMAC(hmacBase, index, data), mac[:]) {
+			return nil, fmt.Errorf("database block %d is corrupted", index)
+		}
+		if n == 0 {
+			return out, nil
+		}
+		out = append(out, data...)
+	}
+}
+
+func writeBlocks(w *bytes.Buffer, hmacBase, data []byte) {
+	for index := uint64(0); ; index++ {
+		n := min(len(data), blockSize)
+		w.Write(blockMAC(hmacBase, index, data[:n]))
+		_ = binary.Write(w, binary.LittleEndian, uint32(n))
+		w.Write(data[:n])
+		if n == 0 {
+			return
+		}
+		data = data[n:]
+	}
+}
+
+func decrypt(cipherID, key, iv, ciphertext []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(cipherID, cipherAES256):
+		if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+			return nil, errors.New("database payload is corrupted")
+		}
+		block, _ := aes.NewCipher(key)
+		out := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, ciphertext)
+		pad := int(out[len(out)-1])
+		if pad < 1 || pad > aes.BlockSize || pad > len(out) {
+			return nil, errors.New("database payload has invalid padding")
+		}
+		return out[:len(out)-pad], nil
+	case bytes.Equal(cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ChaCha20 parameters: %v", err)
+		}
+		out := make([]byte, len(ciphertext))
+		c.XORKeyStream(out, ciphertext)
+		return out, nil
+	case bytes.Equal(cipherID, cipherTwofish):
+		return nil, errors.New("Twofish databases are not supported, switch the cipher to AES or ChaCha20 first")
+	}
+	return nil, fmt.Errorf("unknown cipher %x", cipherID)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("database payload is corrupted: %v", err)
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, maxPayload+1))
+	if err != nil {
+		return nil, fmt.Errorf("database payload is corrupted: %v", err)
+	}
+	if len(out) > maxPayload {
+		return nil, errors.New("database payload is too large")
+	}
+	return out, nil
+}
+
+// decodePayload reads the inner header and the XML document.
+func decodePayload(payload []byte) (*Database, error) {
+	r := bytes.NewReader(payload)
+	var streamID uint32
+	var streamKey []byte
+	var binaries [][]byte
+	for done := false; !done; {
+		id, field, err := readField(r)
+		if err != nil {
+			return nil, errors.New("inner header is truncated or corrupted")
+		}
+		switch id {
+		case innerEnd:
+			done = true
+		case innerStreamID:
+			if len(field) != 4 {
+				return nil, errors.New("inner header has an invalid stream id")
+			}
+			streamID = binary.LittleEndian.Uint32(field)
+		case innerStreamKey:
+			streamKey = field
+		case innerBinary:
+			if len(field) == 0 {
+				return nil, errors.New("inner header has an empty attachment")
+			}
+			binaries = append(binaries, field[1:]) // first byte holds flags
+		}
+	}
+	stream, err := newInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return parseXML(payload[len(payload)-r.Len():], stream, binaries)
+}
+
+// Encode encrypts entries into a new KDBX 4 database using AES-256,
+// Argon2id with ExportKDF and gzip compression.
+func Encode(db *Database, key Key) ([]byte, error) {
+	composite, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+	masterSeed, iv, salt, streamKey := make([]byte, 32), make([]byte, aes.BlockSize), make([]byte, 32), make([]byte, 64)
+	for _, b := range [][]byte{masterSeed, iv, salt, streamKey} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	kdf := variantDict{
+		"$UUID": kdfArgon2id,
+		"S":     salt,
+		"M":     ExportKDF.Memory,
+		"I":     ExportKDF.Iterations,
+		"P":     ExportKDF.Parallelism,
+		"V":     uint32(argon2Version),
+	}
+	transformed, err := transformKey(composite, kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	_ = binary.Write(&header, binary.LittleEndian, [3]uint32{signature1, signature2, version4 << 16})
+	writeField(&header, hdrCipherID, cipherAES256)
+	writeField(&header, hdrCompression, binary.LittleEndian.AppendUint32(nil, 1))
+	writeField(&header, hdrMasterSeed, masterSeed)
+	writeField(&header, hdrEncryptionIV, iv)
+	writeField(&header, hdrKdfParams, kdf.marshal())
+	writeField(&header, hdrEnd, []byte("\r\n\r\n"))
+
+	// inner header and XML
+	stream, err := newInnerStream(streamChaCha20, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	doc, binaries, err := buildXML(db, stream)
+	if err != nil {
+		return nil, err
+	}
+	var payload bytes.Buffer
+	writeField(&payload, innerStreamID, binary.LittleEndian.AppendUint32(nil, streamChaCha20))
+	writeField(&payload, innerStreamKey, streamKey)
+	for _, b := range binaries {
+		writeField(&payload, innerBinary, append([]byte{1}, b...))
+	}
+	writeField(&payload, innerEnd, nil)
+	payload.Write(doc)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(payload.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	plain := compressed.Bytes()
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	encKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformed...))
+	block, _ := aes.NewCipher(encKey[:])
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plain)
+
+	hmacBase := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformed...), 1))
+	out := bytes.NewBuffer(append([]byte{}, header.Bytes()...))
+	sum := sha256.Sum256(header.Bytes())
+	out.Write(sum[:])
+	out.Write(headerMAC(hmacBase[:], header.Bytes()))
+	writeBlocks(out, hmacBase[:], ciphertext)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,176 @@
+package kdbx
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata were written by an independent KDBX 4 writer.
+// aes-argon2d.kdbx has a recycle bin, an entry history, custom and protected
+// fields and two attachments.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecode_AESArgon2d(t *testing.T) {
+	db, err := Decode(readFixture(t, "aes-argon2d.kdbx"), Key{Password: []byte("correct horse battery staple")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Database{
+		Name: "Fixture",
+		Entries: []Entry{
+			{Title: "router", Fields: map[string]string{
+				"UserName": "admin", "Password": "hunter2", "URL": "http://192.168.1.1", "Notes": "line one\nline & two",
+			}},
+			{Title: "gmail", Group: []string{"Email"}, Fields: map[string]string{
+				"UserName": "me@example.com", "Password": "pässwörd ✓", "URL": "https://mail.google.com", "Notes": "",
+				"Recovery code": "ABCD-EFGH", "otp": "otpauth://totp/gmail?secret=JBSWY3DPEHPK3PXP",
+			}, Files: map[string][]byte{"backup-codes.txt": []byte("1111 2222 3333\n")}},
+			{Title: "outlook", Group: []string{"Email", "Work"}, Fields: map[string]string{
+				"UserName": "me@corp.example", "Password": "c0rp!",
+			}, Files: map[string][]byte{"vpn.conf": []byte("remote vpn.corp.example 1194\n")}},
+		},
+	}
+	if !reflect.DeepEqual(db, want) {
+		t.Errorf("got %+v\nwant %+v", db, want)
+	}
+}
+
+func TestDecode_ChaCha20KeyFile(t *testing.T) {
+	key := Key{Password: []byte("open sesame"), KeyFile: readFixture(t, "keyfile.keyx")}
+	db, err := Decode(readFixture(t, "chacha20-argon2id-keyfile.kdbx"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSmall(t, db)
+
+	key.KeyFile = nil
+	if _, err := Decode(readFixture(t, "chacha20-argon2id-keyfile.kdbx"), key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("without the key file: err = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestDecode_AESKDFKeyFileOnly(t *testing.T) {
+	db, err := Decode(readFixture(t, "aeskdf-keyfile-only.kdbx"), Key{KeyFile: readFixture(t, "keyfile.hex")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSmall(t, db)
+}
+
+func checkSmall(t *testing.T, db *Database) {
+	t.Helper()
+	if len(db.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(db.Entries))
+	}
+	e := db.Entries[1]
+	if e.Title != "console" || strings.Join(e.Group, "/") != "Cloud/AWS" || e.Fields["Password"] != "aws-secret" || e.Fields["Account"] != "123456789012" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if db.Entries[0].Fields["Password"] != "s3rv3r" {
+		t.Errorf("unexpected entry %+v", db.Entries[0])
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	data := readFixture(t, "aes-argon2d.kdbx")
+	if _, err := Decode(data, Key{Password: []byte("wrong")}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidKey", err)
+	}
+	if _, err := Decode(data, Key{}); err == nil {
+		t.Error("expected an error without a key")
+	}
+	if _, err := Decode([]byte("not a database"), Key{Password: []byte("x")}); err == nil {
+		t.Error("expected an error for garbage")
+	}
+
+	damaged := bytes.Clone(data)
+	damaged[len(damaged)-50] ^= 1
+	if _, err := Decode(damaged, Key{Password: []byte("correct horse battery staple")}); err == nil || errors.Is(err, ErrInvalidKey) {
+		t.Errorf("damaged block: err = %v", err)
+	}
+	for _, n := range []int{10, 100, len(data) - 10} {
+		if _, err := Decode(data[:n], Key{Password: []byte("correct horse battery staple")}); err == nil {
+			t.Errorf("truncated to %d bytes: expected an error", n)
+		}
+	}
+}
+
+func TestTransformKeyLimits(t *testing.T) {
+	salt := bytes.Repeat([]byte{1}, 32)
+	for _, tt := range []struct {
+		name string
+		kdf  variantDict
+	}{
+		{"AES rounds", variantDict{"$UUID": kdfAES, "S": salt, "R": uint64(1) << 63}},
+		{"Argon2 iterations", variantDict{"$UUID": kdfArgon2d, "S": salt, "M": uint64(64 << 20), "I": uint64(1) << 20, "P": uint32(1), "V": uint32(argon2Version)}},
+		{"Argon2 memory and iterations", variantDict{"$UUID": kdfArgon2id, "S": salt, "M": uint64(maxArgon2Memory), "I": uint64(17), "P": uint32(1), "V": uint32(argon2Version)}},
+	} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := transformKey(make([]byte, 32), tt.kdf)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("%s: expected the parameters to be rejected", tt.name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the key derivation ran instead of being rejected", tt.name)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	defer func(p Argon2Params) { ExportKDF = p }(ExportKDF)
+	ExportKDF = Argon2Params{Memory: 64 << 10, Iterations: 2, Parallelism: 2}
+
+	in := &Database{Name: "export", Entries: []Entry{
+		{Title: "top", Fields: map[string]string{"UserName": "u", "Password": "p", "URL": "", "Notes": ""}},
+		{Title: "deep", Group: []string{"a", "b"}, Fields: map[string]string{
+			"UserName": "", "Password": "<&\"'> ünïcode", "URL": "https://x.example", "Notes": "multi\nline", "custom": "value",
+		}, Files: map[string][]byte{"f.bin": {0, 1, 2, 255}, "g.txt": []byte("text")}},
+		{Title: "sibling", Group: []string{"a"}, Fields: map[string]string{"UserName": "", "Password": "s", "URL": "", "Notes": ""}},
+	}}
+	key := Key{Password: []byte("pw"), KeyFile: readFixture(t, "keyfile.keyx")}
+	data, err := Encode(in, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decode(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries come back grouped: top, then group a (sibling, then a/b)
+	in.Entries[1], in.Entries[2] = in.Entries[2], in.Entries[1]
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestKeyFileKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	if k, _ := keyFileKey(raw); !bytes.Equal(k, raw) {
+		t.Error("32-byte key file should be used as is")
+	}
+	v1 := []byte(`<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=</Data></Key></KeyFile>`)
+	if k, err := keyFileKey(v1); err != nil || !bytes.Equal(k, raw) {
+		t.Errorf("v1 key file: %x, %v", k, err)
+	}
+	bad := bytes.Replace(readFixture(t, "keyfile.keyx"), []byte("Hash=\""), []byte("Hash=\"0"), 1)
+	if _, err := keyFileKey(bad); err == nil {
+		t.Error("expected a checksum error")
+	}
+}
@@ -0,0 +1,64 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// keyFileKey turns the contents of a key file into the 32 bytes that go into
+// the composite key. KeePass accepts XML key files (versions 1.0 and 2.0),
+// 32 raw bytes, 64 hex digits, and hashes anything else.
+func keyFileKey(data []byte) ([]byte, error) {
+	if bytes.Contains(data[:min(len(data), 512)], []byte("<KeyFile")) {
+		return xmlKeyFile(data)
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func xmlKeyFile(data []byte) ([]byte, error) {
+	var kf struct {
+		Version string `xml:"Meta>Version"`
+		Data    struct {
+			Hash  string `xml:"Hash,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Key>Data"`
+	}
+	if err := xml.Unmarshal(data, &kf); err != nil {
+		return nil, errors.New("invalid key file: " + err.Error())
+	}
+	switch strings.TrimSpace(kf.Version) {
+	case "1.0", "1.00":
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kf.Data.Value))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("invalid key file: bad key data")
+		}
+		return key, nil
+	case "2.0":
+		key, err := hex.DecodeString(strings.Join(strings.Fields(kf.Data.Value), ""))
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("invalid key file: bad key data")
+		}
+		if kf.Data.Hash != "" {
+			sum := sha256.Sum256(key)
+			if !strings.EqualFold(hex.EncodeToString(sum[:4]), kf.Data.Hash) {
+				return nil, errors.New("invalid key file: checksum mismatch")
+			}
+		}
+		return key, nil
+	}
+	return nil, errors.New("invalid key file: unsupported version " + kf.Version)
+}
@@ -0,0 +1,56 @@
+package kdbx
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// keyStream encrypts protected values inside the XML document. Values are
+// processed in document order with a single stream.
+type keyStream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+func newInnerStream(id uint32, key []byte) (keyStream, error) {
+	if len(key) == 0 {
+		return nil, errors.New("inner header has no stream key")
+	}
+	switch id {
+	case streamChaCha20:
+		h := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(h[:32], h[32:44])
+	case streamSalsa20:
+		s := &salsaStream{key: sha256.Sum256(key)}
+		copy(s.counter[:8], []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A})
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported inner stream cipher %d", id)
+}
+
+// salsaStream is Salsa20 with its state kept between calls, which
+// golang.org/x/crypto/salsa20 doesn't offer.
+type salsaStream struct {
+	key     [32]byte
+	counter [16]byte // nonce, then the block counter
+	buf     [64]byte
+	used    int // bytes of buf already consumed
+}
+
+func (s *salsaStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == 0 || s.used == len(s.buf) {
+			var zero [64]byte
+			salsa.XORKeyStream(s.buf[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+			s.used = 0
+		}
+		dst[i] = src[i] ^ s.buf[s.used]
+		s.used++
+	}
+}
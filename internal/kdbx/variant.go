@@ -0,0 +1,123 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// variantDict is KeePass's typed key-value map, used for the KDF parameters.
+type variantDict map[string]any
+
+const (
+	vdVersion = 0x0100
+
+	vdUint32 = 0x04
+	vdUint64 = 0x05
+	vdBool   = 0x08
+	vdInt32  = 0x0C
+	vdInt64  = 0x0D
+	vdString = 0x18
+	vdBytes  = 0x42
+)
+
+func parseVariantDict(b []byte) (variantDict, error) {
+	if len(b) < 2 || binary.LittleEndian.Uint16(b)&0xFF00 != vdVersion&0xFF00 {
+		return nil, errors.New("unsupported version")
+	}
+	b = b[2:]
+	d := variantDict{}
+	for {
+		if len(b) < 1 {
+			return nil, errors.New("truncated")
+		}
+		kind := b[0]
+		if kind == 0 {
+			return d, nil
+		}
+		key, rest, err := lengthPrefixed(b[1:])
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := lengthPrefixed(rest)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+
+		size := map[byte]int{vdUint32: 4, vdUint64: 8, vdBool: 1, vdInt32: 4, vdInt64: 8}
+		if n, ok := size[kind]; ok && len(value) != n {
+			return nil, fmt.Errorf("%s has the wrong size", key)
+		}
+		switch kind {
+		case vdUint32:
+			d[string(key)] = binary.LittleEndian.Uint32(value)
+		case vdUint64:
+			d[string(key)] = binary.LittleEndian.Uint64(value)
+		case vdBool:
+			d[string(key)] = value[0] != 0
+		case vdInt32:
+			d[string(key)] = int32(binary.LittleEndian.Uint32(value))
+		case vdInt64:
+			d[string(key)] = int64(binary.LittleEndian.Uint64(value))
+		case vdString:
+			d[string(key)] = string(value)
+		case vdBytes:
+			d[string(key)] = value
+		default:
+			return nil, fmt.Errorf("%s has unknown type %#x", key, kind)
+		}
+	}
+}
+
+func lengthPrefixed(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("truncated")
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, errors.New("truncated")
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+// marshal encodes the dictionary with its keys sorted.
+func (d variantDict) marshal() []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(vdVersion))
+	for _, key := range slices.Sorted(maps.Keys(d)) {
+		var kind byte
+		var value []byte
+		switch x := d[key].(type) {
+		case uint32:
+			kind, value = vdUint32, binary.LittleEndian.AppendUint32(nil, x)
+		case uint64:
+			kind, value = vdUint64, binary.LittleEndian.AppendUint64(nil, x)
+		case bool:
+			kind, value = vdBool, []byte{0}
+			if x {
+				value[0] = 1
+			}
+		case int32:
+			kind, value = vdInt32, binary.LittleEndian.AppendUint32(nil, uint32(x))
+		case int64:
+			kind, value = vdInt64, binary.LittleEndian.AppendUint64(nil, uint64(x))
+		case string:
+			kind, value = vdString, []byte(x)
+		case []byte:
+			kind, value = vdBytes, x
+		default:
+			panic(fmt.Sprintf("kdbx: unsupported variant type %T", x))
+		}
+		buf.WriteByte(kind)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(key)))
+		buf.WriteString(key)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(value)))
+		buf.Write(value)
+	}
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
@@ -0,0 +1,327 @@
+package kdbx
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Standard string fields of an entry.
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+// Database is the decrypted content of a KDBX file.
+type Database struct {
+	Name    string
+	Entries []Entry
+}
+
+// Entry is one KeePass entry. Entries in the recycle bin and the history of
+// entries are not included.
+type Entry struct {
+	Group  []string // names of the groups above the entry, without the root group
+	Title  string
+	Fields map[string]string // every string field but Title, standard and custom
+	Files  map[string][]byte // attachments
+}
+
+// node is a generic XML element. The document is kept as a tree so that
+// protected values are visited in document order, which the inner stream
+// cipher depends on, and unknown elements don't get in the way.
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Nodes   []*node    `xml:",any"`
+}
+
+func elem(name string, children ...*node) *node {
+	return &node{XMLName: xml.Name{Local: name}, Nodes: children}
+}
+
+func textElem(name, text string) *node {
+	return &node{XMLName: xml.Name{Local: name}, Text: text}
+}
+
+func (n *node) child(name string) *node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Nodes {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) text(name string) string {
+	if c := n.child(name); c != nil {
+		return c.Text
+	}
+	return ""
+}
+
+func (n *node) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *node) protected() bool {
+	return n.XMLName.Local == "Value" && n.attr("Protected") == "True"
+}
+
+// unprotect decrypts every protected value in document order.
+func (n *node) unprotect(stream keyStream) error {
+	if n.protected() {
+		ct, err := base64.StdEncoding.DecodeString(n.Text)
+		if err != nil {
+			return errors.New("invalid protected value")
+		}
+		stream.XORKeyStream(ct, ct)
+		n.Text = string(ct)
+	}
+	for _, c := range n.Nodes {
+		if err := c.unprotect(stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protect is the reverse of unprotect.
+func (n *node) protect(stream keyStream) {
+	if n.protected() {
+		ct := []byte(n.Text)
+		stream.XORKeyStream(ct, ct)
+		n.Text = base64.StdEncoding.EncodeToString(ct)
+	}
+	for _, c := range n.Nodes {
+		c.protect(stream)
+	}
+}
+
+func parseXML(doc []byte, stream keyStream, binaries [][]byte) (*Database, error) {
+	var root node
+	if err := xml.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("invalid database XML: %v", err)
+	}
+	if root.XMLName.Local != "KeePassFile" {
+		return nil, errors.New("invalid database XML: no KeePassFile element")
+	}
+	if err := root.unprotect(stream); err != nil {
+		return nil, err
+	}
+
+	db := &Database{}
+	meta := root.child("Meta")
+	db.Name = meta.text("DatabaseName")
+	recycleBin := ""
+	if meta.text("RecycleBinEnabled") != "False" {
+		recycleBin = meta.text("RecycleBinUUID")
+	}
+	top := root.child("Root").child("Group")
+	if top == nil {
+		return nil, errors.New("invalid database XML: no root group")
+	}
+	if err := db.collect(top, nil, recycleBin, binaries); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *Database) collect(g *node, path []string, recycleBin string, binaries [][]byte) error {
+	for _, c := range g.Nodes {
+		switch c.XMLName.Local {
+		case "Entry":
+			e, err := parseEntry(c, binaries)
+			if err != nil {
+				return err
+			}
+			e.Group = slices.Clone(path)
+			db.Entries = append(db.Entries, e)
+		case "Group":
+			if recycleBin != "" && c.text("UUID") == recycleBin {
+				continue
+			}
+			if err := db.collect(c, append(path, c.text("Name")), recycleBin, binaries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseEntry(n *node, binaries [][]byte) (Entry, error) {
+	e := Entry{Fields: map[string]string{}}
+	for _, c := range n.Nodes {
+		key := c.text("Key")
+		switch c.XMLName.Local {
+		case "String":
+			if key == FieldTitle {
+				e.Title = c.text("Value")
+			} else {
+				e.Fields[key] = c.text("Value")
+			}
+		case "Binary":
+			ref, err := strconv.Atoi(c.child("Value").attr("Ref"))
+			if err != nil || ref < 0 || ref >= len(binaries) {
+				return e, fmt.Errorf("attachment %q refers to a missing binary", key)
+			}
+			if e.Files == nil {
+				e.Files = map[string][]byte{}
+			}
+			e.Files[key] = binaries[ref]
+		}
+	}
+	return e, nil
+}
+
+// kdbxTime encodes t as KDBX 4 does: seconds since 0001-01-01 as a
+// base64 little-endian int64.
+func kdbxTime(t time.Time) string {
+	secs := t.Unix() + 62135596800 // Unix epoch in seconds since 0001-01-01
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, uint64(secs)))
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func times(now string) *node {
+	return elem("Times",
+		textElem("CreationTime", now),
+		textElem("LastModificationTime", now),
+		textElem("LastAccessTime", now),
+		textElem("ExpiryTime", now),
+		textElem("Expires", "False"),
+		textElem("UsageCount", "0"),
+		textElem("LocationChanged", now))
+}
+
+// groupBuilder collects a group's entries and subgroups, so entries can be
+// written before groups as KeePass does.
+type groupBuilder struct {
+	node    *node
+	entries []*node
+	groups  []*groupBuilder
+	byName  map[string]*groupBuilder
+}
+
+func newGroup(name, now string) (*groupBuilder, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &groupBuilder{
+		node:   elem("Group", textElem("UUID", uuid), textElem("Name", name), times(now), textElem("IsExpanded", "True")),
+		byName: map[string]*groupBuilder{},
+	}, nil
+}
+
+func (g *groupBuilder) finish() *node {
+	g.node.Nodes = append(g.node.Nodes, g.entries...)
+	for _, sub := range g.groups {
+		g.node.Nodes = append(g.node.Nodes, sub.finish())
+	}
+	return g.node
+}
+
+// buildXML writes the XML document for db, protecting passwords with stream,
+// and returns it with the attachments for the inner header.
+func buildXML(db *Database, stream keyStream) ([]byte, [][]byte, error) {
+	now := kdbxTime(time.Now())
+	name := db.Name
+	if name == "" {
+		name = "gopass"
+	}
+	root, err := newGroup(name, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var binaries [][]byte
+	for _, e := range db.Entries {
+		g := root
+		for _, part := range e.Group {
+			sub, ok := g.byName[part]
+			if !ok {
+				if sub, err = newGroup(part, now); err != nil {
+					return nil, nil, err
+				}
+				g.byName[part] = sub
+				g.groups = append(g.groups, sub)
+			}
+			g = sub
+		}
+
+		uuid, err := newUUID()
+		if err != nil {
+			return nil, nil, err
+		}
+		entry := elem("Entry", textElem("UUID", uuid), times(now))
+		str := func(key, value string) {
+			v := textElem("Value", value)
+			if key == FieldPassword {
+				v.Attrs = []xml.Attr{{Name: xml.Name{Local: "Protected"}, Value: "True"}}
+			}
+			entry.Nodes = append(entry.Nodes, elem("String", textElem("Key", key), v))
+		}
+		str(FieldTitle, e.Title)
+		standard := []string{FieldUserName, FieldPassword, FieldURL, FieldNotes}
+		for _, key := range standard {
+			str(key, e.Fields[key])
+		}
+		for _, key := range slices.Sorted(maps.Keys(e.Fields)) {
+			if !slices.Contains(standard, key) && key != FieldTitle {
+				str(key, e.Fields[key])
+			}
+		}
+		for _, file := range slices.Sorted(maps.Keys(e.Files)) {
+			ref := textElem("Value", "")
+			ref.Attrs = []xml.Attr{{Name: xml.Name{Local: "Ref"}, Value: strconv.Itoa(len(binaries))}}
+			entry.Nodes = append(entry.Nodes, elem("Binary", textElem("Key", file), ref))
+			binaries = append(binaries, e.Files[file])
+		}
+		g.entries = append(g.entries, entry)
+	}
+
+	doc := elem("KeePassFile",
+		elem("Meta",
+			textElem("Generator", "gopass"),
+			textElem("DatabaseName", name),
+			elem("MemoryProtection",
+				textElem("ProtectTitle", "False"),
+				textElem("ProtectUserName", "False"),
+				textElem("ProtectPassword", "True"),
+				textElem("ProtectURL", "False"),
+				textElem("ProtectNotes", "False")),
+			textElem("RecycleBinEnabled", "False")),
+		elem("Root", root.finish(), elem("DeletedObjects")))
+	doc.protect(stream)
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]byte(xml.Header), out...), binaries, nil
+}
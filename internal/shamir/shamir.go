@@ -0,0 +1,139 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8), splitting a
+// secret byte-wise into shares of which any threshold can rebuild it.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	// 3 generates the multiplicative group of GF(2^8) with the AES polynomial
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		x = mulNoTable(x, 3)
+	}
+}
+
+func mulNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Share is one point of the split polynomials: X is the evaluation point and
+// Y holds one byte per byte of the secret.
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// Split divides secret into n shares, any threshold of which recover it.
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < threshold {
+		return nil, errors.New("number of shares must not be smaller than the threshold")
+	}
+	if n > 255 {
+		return nil, errors.New("at most 255 shares are supported")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's rule
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = mul(y, shares[i].X) ^ coeffs[c]
+			}
+			shares[i].Y[b] = y
+		}
+	}
+	clear(coeffs)
+	return shares, nil
+}
+
+// Combine rebuilds the secret from at least threshold distinct shares using
+// Lagrange interpolation at x = 0. With too few shares the result is garbage,
+// callers must verify it.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+	size := len(shares[0].Y)
+	seen := make(map[byte]bool)
+	for _, s := range shares {
+		if s.X == 0 {
+			return nil, errors.New("invalid share index 0")
+		}
+		if seen[s.X] {
+			return nil, fmt.Errorf("share %d was given twice", s.X)
+		}
+		seen[s.X] = true
+		if len(s.Y) != size {
+			return nil, errors.New("shares have different lengths")
+		}
+	}
+
+	secret := make([]byte, size)
+	for i, si := range shares {
+		// basis polynomial l_i(0) = prod x_j / (x_j - x_i)
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			basis = mul(basis, div(sj.X, sj.X^si.X))
+		}
+		for b := range secret {
+			secret[b] ^= mul(si.Y[b], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,113 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+// subsets calls fn with every subset of shares of size k.
+func subsets(shares []Share, k int, fn func([]Share)) {
+	var pick func(start int, chosen []Share)
+	pick = func(start int, chosen []Share) {
+		if len(chosen) == k {
+			fn(append([]Share{}, chosen...))
+			return
+		}
+		for i := start; i < len(shares); i++ {
+			pick(i+1, append(chosen, shares[i]))
+		}
+	}
+	pick(0, nil)
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	for _, tt := range []struct{ n, threshold int }{
+		{2, 2},
+		{3, 2},
+		{5, 3},
+		{6, 6},
+		{7, 4},
+	} {
+		shares, err := Split(secret, tt.n, tt.threshold)
+		if err != nil {
+			t.Fatalf("%d of %d: %v", tt.threshold, tt.n, err)
+		}
+		if len(shares) != tt.n {
+			t.Fatalf("%d of %d: got %d shares", tt.threshold, tt.n, len(shares))
+		}
+		for k := tt.threshold; k <= tt.n; k++ {
+			subsets(shares, k, func(s []Share) {
+				got, err := Combine(s)
+				if err != nil {
+					t.Fatalf("%d of %d, %d shares: %v", tt.threshold, tt.n, k, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Fatalf("%d of %d: shares %v don't rebuild the secret", tt.threshold, tt.n, xs(s))
+				}
+			})
+		}
+		if tt.threshold-1 < 2 {
+			continue
+		}
+		subsets(shares, tt.threshold-1, func(s []Share) {
+			got, err := Combine(s)
+			if err != nil {
+				t.Fatalf("%d of %d, too few shares: %v", tt.threshold, tt.n, err)
+			}
+			if bytes.Equal(got, secret) {
+				t.Fatalf("%d of %d: shares %v rebuild the secret below the threshold", tt.threshold, tt.n, xs(s))
+			}
+		})
+	}
+}
+
+func xs(shares []Share) []byte {
+	out := make([]byte, len(shares))
+	for i, s := range shares {
+		out[i] = s.X
+	}
+	return out
+}
+
+func TestSplitRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		secret       []byte
+		n, threshold int
+	}{
+		{"threshold of one", []byte("s"), 3, 1},
+		{"fewer shares than threshold", []byte("s"), 2, 3},
+		{"too many shares", []byte("s"), 256, 2},
+		{"empty secret", nil, 3, 2},
+	} {
+		if _, err := Split(tt.secret, tt.n, tt.threshold); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestCombineRejects(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := shares[1]
+	zero.X = 0
+	short := shares[1]
+	short.Y = short.Y[:3]
+	for _, tt := range []struct {
+		name   string
+		shares []Share
+	}{
+		{"one share", shares[:1]},
+		{"duplicate x", []Share{shares[0], shares[0]}},
+		{"duplicate x, different y", []Share{shares[0], {X: shares[0].X, Y: shares[1].Y}}},
+		{"zero x", []Share{shares[0], zero}},
+		{"different lengths", []Share{shares[0], short}},
+	} {
+		if _, err := Combine(tt.shares); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
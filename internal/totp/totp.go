@@ -0,0 +1,130 @@
+// Package totp parses otpauth:// URIs and generates RFC 6238 time-based
+// one-time passwords.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key holds the parameters of a TOTP generator.
+type Key struct {
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string // SHA1, SHA256 or SHA512
+	Digits    int
+	Period    time.Duration
+}
+
+// maxPeriod bounds the period of a URI; longer ones overflow a Duration.
+const maxPeriod = 24 * 60 * 60
+
+// ParseURI decodes an otpauth://totp/ URI. Missing parameters default to
+// SHA1, 6 digits and a 30 second period, as authenticator apps do.
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth URI: %v", err)
+	}
+	if u.Scheme != "otpauth" {
+		return nil, errors.New("URI must start with otpauth://")
+	}
+	if u.Host != "totp" {
+		return nil, fmt.Errorf("unsupported OTP type %q, only totp is supported", u.Host)
+	}
+
+	k := &Key{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		k.Issuer, k.Account = issuer, strings.TrimSpace(account)
+	} else {
+		k.Account = label
+	}
+
+	q := u.Query()
+	secret := strings.ToUpper(strings.ReplaceAll(q.Get("secret"), " ", ""))
+	if secret == "" {
+		return nil, errors.New("otpauth URI has no secret")
+	}
+	k.Secret, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, errors.New("otpauth secret is not valid base32")
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		k.Issuer = issuer
+	}
+	if alg := q.Get("algorithm"); alg != "" {
+		k.Algorithm = strings.ToUpper(alg)
+	}
+	if _, err := k.hash(); err != nil {
+		return nil, err
+	}
+	if d := q.Get("digits"); d != "" {
+		if k.Digits, err = strconv.Atoi(d); err != nil || k.Digits < 6 || k.Digits > 8 {
+			return nil, errors.New("digits must be between 6 and 8")
+		}
+	}
+	if p := q.Get("period"); p != "" {
+		secs, err := strconv.Atoi(p)
+		if err != nil || secs <= 0 || secs > maxPeriod {
+			return nil, fmt.Errorf("period must be between 1 and %d seconds", maxPeriod)
+		}
+		k.Period = time.Duration(secs) * time.Second
+	}
+	return k, nil
+}
+
+func (k *Key) hash() (func() hash.Hash, error) {
+	switch k.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+}
+
+// Code returns the code valid at t and how long it stays valid.
+func (k *Key) Code(t time.Time) (string, time.Duration, error) {
+	h, err := k.hash()
+	if err != nil {
+		return "", 0, err
+	}
+	period := int64(k.Period / time.Second)
+	if period <= 0 {
+		return "", 0, errors.New("period must be at least one second")
+	}
+	counter := uint64(t.Unix() / period)
+	remaining := time.Duration(period-t.Unix()%period) * time.Second
+	return hotp(h, k.Secret, counter, k.Digits), remaining, nil
+}
+
+// hotp is the RFC 4226 HMAC-based one-time password.
+func hotp(h func() hash.Hash, secret []byte, counter uint64, digits int) string {
+	mac := hmac.New(h, secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"encoding/base32"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, 8 digits, 30 second period.
+func TestCodeRFC6238Vectors(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		unix int64
+		alg  string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, v := range vectors {
+		secret := base32.StdEncoding.EncodeToString([]byte(seeds[v.alg]))
+		uri := fmt.Sprintf("otpauth://totp/Example:alice?secret=%s&algorithm=%s&digits=8&period=30", secret, v.alg)
+		k, err := ParseURI(uri)
+		if err != nil {
+			t.Fatalf("parse %s: %v", uri, err)
+		}
+		clock := func() time.Time { return time.Unix(v.unix, 0) }
+		code, _, err := k.Code(clock())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("%s at %d: got %s, want %s", v.alg, v.unix, code, v.code)
+		}
+	}
+}
+
+func TestCodeRemainingAndDefaults(t *testing.T) {
+	k, err := ParseURI("otpauth://totp/ACME%20Co:john@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=ACME%20Co")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Issuer != "ACME Co" || k.Account != "john@example.com" || k.Digits != 6 || k.Period != 30*time.Second {
+		t.Fatalf("unexpected key %+v", k)
+	}
+	code, remaining, err := k.Code(time.Unix(59, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" || remaining != time.Second {
+		t.Fatalf("got %s valid for %v", code, remaining)
+	}
+
+	k.Period = 60 * time.Second
+	if _, remaining, _ = k.Code(time.Unix(75, 0)); remaining != 45*time.Second {
+		t.Fatalf("custom period: got %v remaining", remaining)
+	}
+}
+
+func TestParseURIRejectsInvalid(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com",
+		"otpauth://hotp/x?secret=GEZDGNBV&counter=1",
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=!!!",
+		"otpauth://totp/x?secret=GEZDGNBV&algorithm=MD5",
+		"otpauth://totp/x?secret=GEZDGNBV&digits=9",
+		"otpauth://totp/x?secret=GEZDGNBV&period=0",
+		"otpauth://totp/x?secret=GEZDGNBV&period=86401",
+		"otpauth://totp/x?secret=GEZDGNBV&period=9223372036",
+	} {
+		if _, err := ParseURI(uri); err == nil {
+			t.Errorf("expected %q to be rejected", uri)
+		}
+	}
+}
+
+func TestCodeRejectsShortPeriod(t *testing.T) {
+	k := &Key{Secret: []byte("12345678901234567890"), Algorithm: "SHA1", Digits: 6, Period: time.Millisecond}
+	if _, _, err := k.Code(time.Unix(59, 0)); err == nil {
+		t.Fatal("expected a period below one second to be rejected")
+	}
+}
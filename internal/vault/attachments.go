@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// DefaultAttachmentLimit is the size limit of a single attachment in bytes
+// unless SetAttachmentLimit changes it.
+const DefaultAttachmentLimit int64 = 1 << 20
+
+// SetAttachmentLimit changes the size limit of a single attachment in bytes,
+// for Attach and for imports. Zero restores DefaultAttachmentLimit.
+func (v *Vault) SetAttachmentLimit(n int64) {
+	v.attachmentLimit = n
+}
+
+// AttachmentLimit returns the size limit of a single attachment in bytes.
+func (v *Vault) AttachmentLimit() int64 {
+	if v.attachmentLimit <= 0 {
+		return DefaultAttachmentLimit
+	}
+	return v.attachmentLimit
+}
+
+// AttachmentInfo describes an attachment without decrypting it.
+type AttachmentInfo struct {
+	Name string
+	Size int64
+}
+
+func (v *Vault) addPendingFile(name, file string, content []byte) {
+	if v.pendingFiles == nil {
+		v.pendingFiles = make(map[string]map[string][]byte)
+	}
+	if v.pendingFiles[name] == nil {
+		v.pendingFiles[name] = make(map[string][]byte)
+	}
+	v.pendingFiles[name][file] = content
+}
+
+// Attach stores content as an encrypted attachment of an existing entry,
+// replacing an attachment of the same name, and saves the vault.
+func (v *Vault) Attach(name, file string, content []byte, filepath string) error {
+	if file == "" {
+		return fmt.Errorf("attachment name cannot be empty")
+	}
+	if !v.Has(name) {
+		return fmt.Errorf("entry with name '%s' doesn't exists", name)
+	}
+	if limit := v.AttachmentLimit(); int64(len(content)) > limit {
+		return fmt.Errorf("attachment is %d bytes, the limit is %d", len(content), limit)
+	}
+	v.addPendingFile(name, file, append([]byte{}, content...))
+	return v.Save(filepath)
+}
+
+// Attachments lists the attachments of an entry, sorted by name.
+func (v *Vault) Attachments(name string) ([]AttachmentInfo, error) {
+	if !v.Has(name) {
+		return nil, fmt.Errorf("'%s' doesnt exist in vault", name)
+	}
+	sizes := make(map[string]int64)
+	for file, ref := range v.index[name].Attachments {
+		sizes[file] = ref.Size
+	}
+	for file, content := range v.pendingFiles[name] {
+		sizes[file] = int64(len(content))
+	}
+	out := make([]AttachmentInfo, 0, len(sizes))
+	for _, file := range slices.Sorted(maps.Keys(sizes)) {
+		out = append(out, AttachmentInfo{Name: file, Size: sizes[file]})
+	}
+	return out, nil
+}
+
+// Attachment decrypts a single attachment. The caller should wipe the
+// returned slice once it's written out.
+func (v *Vault) Attachment(name, file string) ([]byte, error) {
+	if content, ok := v.pendingFiles[name][file]; ok {
+		return append([]byte{}, content...), nil
+	}
+	ref, ok := v.index[name].Attachments[file]
+	if !ok {
+		return nil, fmt.Errorf("entry '%s' has no attachment '%s'", name, file)
+	}
+	content, err := v.openSealed(ref.Record, ref.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("attachment '%s' of '%s': %w", file, name, err)
+	}
+	return content, nil
+}
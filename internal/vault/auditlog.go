@@ -0,0 +1,361 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Every change and every read of a secret (Get, OTP, Export, and the reads
+callers report with LogRead) is appended to an audit log kept next to the
+vault file (<vault>.log), one record per line:
+
+	seq ":" base64(seal(logKey, gob(LogRecord), vaultID | seq))
+
+The log key is random and lives in the vault's encrypted index, so records
+survive key rotation and only people who can open the vault can read them.
+Each record carries the SHA-256 of the previous line, and the index keeps the
+sequence number and hash of the newest record, so VerifyLog detects changed,
+reordered, dropped or truncated records. Appending a record saves the vault
+so the index moves along with the log, even for commands that only read.
+*/
+
+const logKeySize = 32
+
+// logState is the audit log bookkeeping stored in the index.
+type logState struct {
+	Key  []byte
+	Seq  uint64 // newest record known to the vault
+	Head []byte // SHA-256 of that record's line
+}
+
+// LogRecord is one audited operation.
+type LogRecord struct {
+	Seq    uint64
+	Time   time.Time
+	User   string
+	Host   string
+	Op     string // add, get, show, otp, extract, audit, split, remove, purge, import or export
+	Entry  string // entry name, empty for whole-vault operations
+	Detail string
+	Prev   []byte // SHA-256 of the previous line, nil for the first record
+}
+
+// logMark is where the audit log stood before the first record of a batch,
+// so Discard can take the batch's records back.
+type logMark struct {
+	path    string
+	size    int64  // length of the log file
+	seq     uint64 // head the vault knew
+	head    []byte
+	created bool // the batch created the log key
+}
+
+// LogPath returns where the audit log of the vault at filepath is kept.
+func LogPath(filepath string) string {
+	return filepath + ".log"
+}
+
+// logEvent appends a record to the audit log. Failing to log doesn't undo
+// the operation, it is reported on stderr.
+func (v *Vault) logEvent(filepath, op, entry, detail string) {
+	if filepath == "" {
+		return
+	}
+	if err := v.AppendLog(filepath, op, entry, detail); err != nil {
+		fmt.Fprintf(v.env().Out, "Warning: failed to write audit log: %v\n", err)
+	}
+}
+
+// LogRead records in the audit log that the caller read secrets of the
+// vault with Value or Attachment, for commands that show or check them
+// rather than going through Get.
+func (v *Vault) LogRead(op, entry, detail string) {
+	v.logEvent(v.path, op, entry, detail)
+}
+
+// AppendLog appends a record to the audit log of the vault at filepath and
+// saves the vault with the record as the log's new head. The first record of
+// a vault creates the log key.
+func (v *Vault) AppendLog(filepath, op, entry, detail string) error {
+	if err := v.ensureKey(filepath); err != nil {
+		return err
+	}
+	if v.batch > 0 && v.batchLog == nil {
+		if err := v.markLog(filepath); err != nil {
+			return err
+		}
+	}
+	if v.log == nil {
+		if err := v.initLog(); err != nil {
+			return err
+		}
+	}
+
+	rec := LogRecord{Seq: 1, Time: v.env().Now().UTC(), Op: op, Entry: entry, Detail: detail}
+	rec.User, rec.Host = currentUser()
+	last, err := lastLine(LogPath(filepath))
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		prev, err := v.openLogLine(last)
+		if err != nil {
+			return fmt.Errorf("last record can't be read, run 'gopass log verify': %w", err)
+		}
+		h := sha256.Sum256(last)
+		rec.Seq, rec.Prev = prev.Seq+1, h[:]
+	}
+
+	line, err := v.sealLogRecord(&rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(LogPath(filepath), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	h := sha256.Sum256(line)
+	v.log.Seq, v.log.Head = rec.Seq, h[:]
+	return v.saveLogHead(filepath)
+}
+
+// initLog gives the vault a log key. Like the data key it lives as long as
+// the vault, locked in memory until Close releases it.
+func (v *Vault) initLog() error {
+	key := make([]byte, logKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate audit log key: %v", err)
+	}
+	lockKey(key)
+	v.log = &logState{Key: key}
+	return nil
+}
+
+// markLog remembers the state of the log before a batch appends to it.
+func (v *Vault) markLog(filepath string) error {
+	mark := &logMark{path: LogPath(filepath), created: v.log == nil}
+	if info, err := os.Stat(mark.path); err == nil {
+		mark.size = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if v.log != nil {
+		mark.seq, mark.head = v.log.Seq, v.log.Head
+	}
+	v.batchLog = mark
+	return nil
+}
+
+// rewindLog cuts the log back to mark and forgets the records after it.
+func (v *Vault) rewindLog(mark *logMark) error {
+	if mark.created && v.log != nil {
+		releaseKey(v.log.Key)
+		v.log = nil
+	} else if v.log != nil {
+		v.log.Seq, v.log.Head = mark.seq, mark.head
+	}
+	if err := os.Truncate(mark.path, mark.size); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func currentUser() (string, string) {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name, host
+}
+
+func (v *Vault) logAD(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte{}, v.header.ID...), seq)
+}
+
+func (v *Vault) sealLogRecord(rec *LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return nil, fmt.Errorf("failed to encode log record: %v", err)
+	}
+	sealed, err := seal(v.log.Key, buf.Bytes(), v.logAD(rec.Seq))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatUint(rec.Seq, 10) + ":" + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openLogLine decrypts one line of the log and checks it is the record its
+// sequence number claims to be.
+func (v *Vault) openLogLine(line []byte) (*LogRecord, error) {
+	if v.log == nil {
+		return nil, errors.New("vault has no audit log key")
+	}
+	seqText, b64, ok := strings.Cut(string(line), ":")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !ok || err != nil {
+		return nil, errors.New("malformed log line")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, errors.New("malformed log line")
+	}
+	plaintext, err := open(v.log.Key, sealed, v.logAD(seq))
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	var rec LogRecord
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&rec); err != nil || rec.Seq != seq {
+		return nil, ErrIntegrity
+	}
+	return &rec, nil
+}
+
+// lastLine returns the last line of the file at path, nil if it is empty or
+// doesn't exist.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	for chunk := int64(4096); ; chunk *= 2 {
+		start := max(0, size-chunk)
+		buf := make([]byte, size-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			return buf[i+1:], nil
+		}
+		if start == 0 {
+			if len(buf) == 0 {
+				return nil, nil
+			}
+			return buf, nil
+		}
+	}
+}
+
+func readLogLines(filepath string) ([][]byte, error) {
+	f, err := os.Open(LogPath(filepath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, bytes.Clone(scanner.Bytes()))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// Log returns the audit log of the vault at filepath, oldest first. If entry
+// isn't empty only records about that entry are returned.
+func (v *Vault) Log(filepath, entry string) ([]LogRecord, error) {
+	lines, err := readLogLines(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var out []LogRecord
+	for i, line := range lines {
+		rec, err := v.openLogLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("log line %d: %w, run 'gopass log verify'", i+1, err)
+		}
+		if entry == "" || rec.Entry == entry {
+			out = append(out, *rec)
+		}
+	}
+	return out, nil
+}
+
+// VerifyLog checks the audit log of the vault at filepath and returns every
+// problem found: records that were changed, missing, reordered or cut off
+// the end. An empty result means the log is intact.
+func (v *Vault) VerifyLog(filepath string) ([]string, error) {
+	lines, err := readLogLines(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	if v.log == nil {
+		if len(lines) > 0 {
+			problems = append(problems, "the vault has no audit log key, the log can't be verified")
+		}
+		return problems, nil
+	}
+
+	var prevSeq uint64
+	var prevHash []byte
+	var head []byte
+	for i, line := range lines {
+		rec, err := v.openLogLine(line)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: record was modified or isn't from this vault", i+1))
+			prevHash, prevSeq = nil, prevSeq+1
+			continue
+		}
+		switch {
+		case rec.Seq > prevSeq+1:
+			problems = append(problems, fmt.Sprintf("records %d to %d are missing", prevSeq+1, rec.Seq-1))
+		case rec.Seq <= prevSeq:
+			problems = append(problems, fmt.Sprintf("line %d: record %d is out of order or duplicated", i+1, rec.Seq))
+		case prevHash != nil && !bytes.Equal(rec.Prev, prevHash):
+			problems = append(problems, fmt.Sprintf("record %d doesn't chain to the record before it", rec.Seq))
+		}
+		h := sha256.Sum256(line)
+		prevSeq, prevHash = rec.Seq, h[:]
+		if rec.Seq == v.log.Seq {
+			head = prevHash
+		}
+	}
+
+	switch {
+	case v.log.Seq > prevSeq:
+		problems = append(problems, fmt.Sprintf("the log ends at record %d but the vault saw record %d, records were cut off", prevSeq, v.log.Seq))
+	case v.log.Seq > 0 && !bytes.Equal(head, v.log.Head):
+		problems = append(problems, fmt.Sprintf("record %d differs from the one the vault saw", v.log.Seq))
+	}
+	return problems, nil
+}
@@ -0,0 +1,164 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+Save never overwrites the vault in place: the new file is written next to it
+and renamed over it, and the previous file is kept as <vault>.bak.1, shifting
+older backups up to <vault>.bak.N. N is the "backups" setting in ~/.gopassrc
+(5 by default, 0 turns backups off). gopass fsck restores from them.
+*/
+
+const defaultBackups = 5
+
+func backupPath(filepath string, n int) string {
+	return filepath + ".bak." + strconv.Itoa(n)
+}
+
+func backupCount() int {
+	value, err := GetConfigValue("backups")
+	if err != nil || value == "" {
+		return defaultBackups
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return defaultBackups
+	}
+	return n
+}
+
+// CreatePrivateFile creates or truncates path for writing, readable by the
+// owner only. Unlike os.Create it also tightens the permissions of a file
+// that already exists, so plaintext never lands in a world-readable file.
+func CreatePrivateFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// WritePrivateFile writes data to path through CreatePrivateFile.
+func WritePrivateFile(path string, data []byte) error {
+	f, err := CreatePrivateFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFile replaces the vault file with data, keeping the old one as the
+// newest of keep backups. A crash part way leaves either the old or the new
+// file.
+func writeFile(filepath string, data []byte, keep int, warn io.Writer) error {
+	tmp := filepath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := rotateBackups(filepath, keep); err != nil {
+		fmt.Fprintf(warn, "Warning: failed to back up vault: %v\n", err)
+	}
+	return os.Rename(tmp, filepath)
+}
+
+func rotateBackups(filepath string, keep int) error {
+	if keep == 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	_ = os.Remove(backupPath(filepath, keep))
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(filepath, n), backupPath(filepath, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	// the vault is about to be replaced by a rename, so linking is enough
+	if err := os.Link(filepath, backupPath(filepath, 1)); err == nil {
+		return nil
+	}
+	return copyFile(filepath, backupPath(filepath, 1))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Backup is a previous version of a vault file.
+type Backup struct {
+	Path    string
+	ModTime time.Time
+}
+
+// Backups lists the backups of the vault at filepath, newest first.
+func Backups(filepath string) []Backup {
+	var out []Backup
+	for n := 1; n <= max(backupCount(), defaultBackups); n++ {
+		if info, err := os.Stat(backupPath(filepath, n)); err == nil {
+			out = append(out, Backup{Path: backupPath(filepath, n), ModTime: info.ModTime()})
+		}
+	}
+	return out
+}
+
+// RestoreBackup replaces the vault at filepath with a copy of backup. The
+// replaced file is kept as <vault>.damaged-<unix time> and its path returned.
+func RestoreBackup(filepath, backup string) (string, error) {
+	damaged := ""
+	if _, err := os.Stat(filepath); err == nil {
+		damaged = fmt.Sprintf("%s.damaged-%d", filepath, time.Now().Unix())
+		if err := os.Rename(filepath, damaged); err != nil {
+			return "", err
+		}
+	}
+	tmp := filepath + ".tmp"
+	if err := copyFile(backup, tmp); err != nil {
+		return damaged, err
+	}
+	return damaged, os.Rename(tmp, filepath)
+}
@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/prozod/gopass/internal/totp"
+)
+
+/*
+Bitwarden's unencrypted JSON export lists folders, collections (for
+organization exports) and items. Logins and secure notes are imported: the
+folder, or else the first collection, becomes a name prefix, the password (a
+secure note's text) is the value, username, URIs and notes become fields and
+custom fields keep their name. Cards, identities and SSH keys are reported as
+unsupported.
+*/
+
+type bitwardenExport struct {
+	Encrypted   bool              `json:"encrypted"`
+	Folders     []bitwardenFolder `json:"folders"`
+	Collections []bitwardenFolder `json:"collections"`
+	Items       []bitwardenItem   `json:"items"`
+}
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenItem struct {
+	Type          int      `json:"type"`
+	Name          string   `json:"name"`
+	Notes         string   `json:"notes"`
+	FolderID      string   `json:"folderId"`
+	CollectionIDs []string `json:"collectionIds"`
+	Fields        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		Type  int    `json:"type"` // 0 text, 1 hidden, 2 boolean, 3 linked
+	} `json:"fields"`
+	Login *struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		TOTP     string `json:"totp"`
+		URIs     []struct {
+			URI string `json:"uri"`
+		} `json:"uris"`
+	} `json:"login"`
+}
+
+var bitwardenTypes = map[int]string{1: "login", 2: "secure note", 3: "card", 4: "identity", 5: "SSH key"}
+
+// ParseBitwarden reads an unencrypted Bitwarden JSON export. Items that
+// can't be stored are described in unsupported instead.
+func ParseBitwarden(data []byte) (items []Item, unsupported []string, err error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, nil, fmt.Errorf("invalid Bitwarden export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, nil, fmt.Errorf("encrypted Bitwarden exports aren't supported, export as unencrypted JSON")
+	}
+	folders := make(map[string]string)
+	for _, f := range append(export.Folders, export.Collections...) {
+		folders[f.ID] = f.Name
+	}
+
+	for _, bw := range export.Items {
+		prefix := folders[bw.FolderID]
+		if prefix == "" && len(bw.CollectionIDs) > 0 {
+			prefix = folders[bw.CollectionIDs[0]]
+		}
+		if bw.Type != 1 && bw.Type != 2 {
+			kind, ok := bitwardenTypes[bw.Type]
+			if !ok {
+				kind = "type " + strconv.Itoa(bw.Type)
+			}
+			unsupported = append(unsupported, fmt.Sprintf("%s (%s)", joinName(prefix, bw.Name), kind))
+			continue
+		}
+
+		item := Item{Fields: make(map[string]string)}
+		if bw.Login != nil {
+			item.Value = bw.Login.Password
+			item.Fields[FieldUsername] = bw.Login.Username
+			for i, u := range bw.Login.URIs {
+				if i == 0 {
+					item.Fields[FieldURL] = u.URI
+				} else {
+					item.Fields[FieldURL+" "+strconv.Itoa(i+1)] = u.URI
+				}
+			}
+		}
+		item.Fields[FieldNote] = bw.Notes
+		if bw.Type == 2 {
+			item.Value = bw.Notes
+		}
+		for _, f := range bw.Fields {
+			if f.Type != 3 && f.Name != "" {
+				item.Fields[f.Name] = f.Value
+			}
+		}
+		name := bw.Name
+		if name == "" {
+			name = nameFromURL(item.Fields[FieldURL])
+		}
+		if name != "" {
+			item.Name = joinName(prefix, name)
+		}
+		if bw.Login != nil && bw.Login.TOTP != "" {
+			uri, err := otpURI(bw.Login.TOTP, name)
+			if err != nil {
+				unsupported = append(unsupported, fmt.Sprintf("%s: TOTP seed (%v)", item.Name, err))
+			} else {
+				item.Fields[FieldOTP] = uri
+			}
+		}
+		dropEmpty(item.Fields)
+		items = append(items, item)
+	}
+	return items, unsupported, nil
+}
+
+// ImportBitwarden imports an unencrypted Bitwarden JSON export, resolving
+// name collisions as opts says, and saves the vault once.
+func (v *Vault) ImportBitwarden(data []byte, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, unsupported, err := ParseBitwarden(data)
+	if err != nil {
+		return nil, err
+	}
+	report, err := v.importItems(items, opts, filepath, "Bitwarden")
+	if err != nil {
+		return nil, err
+	}
+	report.Unsupported = unsupported
+	return report, nil
+}
+
+// joinName puts a folder or vault name in front of an entry name.
+func joinName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+func dropEmpty(fields map[string]string) {
+	for k, v := range fields {
+		if v == "" {
+			delete(fields, k)
+		}
+	}
+}
+
+// otpURI turns what password managers store as a TOTP seed, either an
+// otpauth:// URI or a bare base32 secret, into a valid otpauth:// URI.
+func otpURI(seed, label string) (string, error) {
+	seed = strings.TrimSpace(seed)
+	if !strings.Contains(seed, "://") {
+		secret := strings.ToUpper(strings.ReplaceAll(seed, " ", ""))
+		seed = "otpauth://totp/" + url.PathEscape(label) + "?secret=" + url.QueryEscape(secret)
+	}
+	if _, err := totp.ParseURI(seed); err != nil {
+		return "", err
+	}
+	return seed, nil
+}
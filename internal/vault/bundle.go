@@ -0,0 +1,185 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+Export bundles carry entries between machines without ever being plaintext
+on disk:
+
+	magic(6) | version(1) | headerLen(4) | gob(header) | AES-GCM(bundleKey, gob(bundleBody))
+
+The header is the vault header: a random bundle key wrapped for a password
+and/or X25519 recipients. Everything before the sealed body is authenticated
+as associated data, so the version, KDF parameters and key stanzas can't be
+changed. Bundles hold every entry with its fields and attachments.
+*/
+
+const (
+	bundleMagic   = "GPBNDL"
+	bundleVersion = 1
+)
+
+// bundleBody is the sealed content of a bundle.
+type bundleBody struct {
+	Created time.Time
+	Source  string // ID of the vault the bundle was exported from
+	Items   []Item
+}
+
+// ErrWrongBundlePassword reports a password that doesn't open a bundle.
+var ErrWrongBundlePassword = errors.New("wrong bundle password")
+
+// IsBundle reports whether data looks like an export bundle.
+func IsBundle(data []byte) bool {
+	return len(data) >= prefixSize && string(data[:len(bundleMagic)]) == bundleMagic
+}
+
+// ExportBundle writes every entry to an encrypted bundle at path, readable
+// with password if it isn't empty and by the identities of recipients
+// (gopass1... public keys). At least one of them is required.
+func (v *Vault) ExportBundle(path, password string, recipients []string) error {
+	if password == "" && len(recipients) == 0 {
+		return errors.New("a bundle needs a password or at least one recipient")
+	}
+	items, err := v.items(true)
+	if err != nil {
+		return err
+	}
+	h, err := newHeader()
+	if err != nil {
+		return err
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer releaseKey(key)
+
+	if password != "" {
+		h.Salt = make([]byte, saltSize)
+		if _, err := rand.Read(h.Salt); err != nil {
+			return fmt.Errorf("salt error: %v", err)
+		}
+		passBytes := []byte(password)
+		h.Password, err = wrapWithPassword(passBytes, h, key)
+		wipe(passBytes)
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range recipients {
+		pub, err := ParseRecipient(r)
+		if err != nil {
+			return err
+		}
+		s, err := wrapForRecipient(pub, key)
+		if err != nil {
+			return err
+		}
+		h.Recipients = append(h.Recipients, s)
+	}
+
+	var hbuf bytes.Buffer
+	if err := gob.NewEncoder(&hbuf).Encode(h); err != nil {
+		return fmt.Errorf("failed to encode bundle header: %v", err)
+	}
+	out := append([]byte(bundleMagic), bundleVersion)
+	out = binary.BigEndian.AppendUint32(out, uint32(hbuf.Len()))
+	out = append(out, hbuf.Bytes()...)
+
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(bundleBody{Created: v.env().Now().UTC(), Source: v.ID(), Items: items}); err != nil {
+		return fmt.Errorf("failed to encode bundle: %v", err)
+	}
+	defer wipe(body.Bytes())
+	sealed, err := seal(key, body.Bytes(), out)
+	if err != nil {
+		return err
+	}
+	if err := WritePrivateFile(path, append(out, sealed...)); err != nil {
+		return err
+	}
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries to %s as an encrypted bundle", len(items), path))
+	return nil
+}
+
+// OpenBundle decrypts a bundle with the local identity or, if that isn't
+// one of its recipients, with a password from reader.
+func OpenBundle(data []byte, reader PasswordReader) ([]Item, error) {
+	if !IsBundle(data) {
+		return nil, errors.New("not a gopass bundle")
+	}
+	if v := data[len(bundleMagic)]; v != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, update gopass", v)
+	}
+	hlen := binary.BigEndian.Uint32(data[len(bundleMagic)+1 : prefixSize])
+	if uint64(len(data)-prefixSize) < uint64(hlen)+nonceSize {
+		return nil, fmt.Errorf("%w: bundle is truncated", ErrIntegrity)
+	}
+	end := prefixSize + int(hlen)
+	var h header
+	if err := gob.NewDecoder(bytes.NewReader(data[prefixSize:end])).Decode(&h); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode bundle header: %v", ErrIntegrity, err)
+	}
+	if err := h.checkKDF(); err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if id := localIdentity(); id != nil {
+		for _, s := range h.Recipients {
+			if k, err := id.unwrap(s); err == nil {
+				key = k
+				break
+			}
+		}
+	}
+	if key == nil {
+		if h.Salt == nil {
+			return nil, errors.New("bundle has no password and your identity isn't one of its recipients")
+		}
+		password, err := reader.Read("Bundle password: ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %v", err)
+		}
+		passBytes := []byte(password)
+		key, err = unwrapWithPassword(passBytes, &h)
+		wipe(passBytes)
+		if errors.Is(err, ErrWrongPassword) {
+			return nil, ErrWrongBundlePassword
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer wipe(key)
+
+	plaintext, err := open(key, data[end:], data[:end])
+	if err != nil {
+		return nil, fmt.Errorf("%w: the bundle was truncated or modified", ErrIntegrity)
+	}
+	defer wipe(plaintext)
+	var body bundleBody
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %v", err)
+	}
+	return body.Items, nil
+}
+
+// ImportBundle imports an encrypted bundle, see OpenBundle, resolving name
+// collisions as opts says, and saves the vault once.
+func (v *Vault) ImportBundle(data []byte, reader PasswordReader, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, err := OpenBundle(data, reader)
+	if err != nil {
+		return nil, err
+	}
+	return v.importItems(items, opts, filepath, "bundle")
+}
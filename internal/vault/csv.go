@@ -0,0 +1,145 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+/*
+CSV files use the layout browsers export and import:
+
+	Chrome:  name,url,username,password,note
+	Firefox: url,username,password,httpRealm,formActionOrigin,guid,...
+
+Columns are matched by header name, so their order doesn't matter and unknown
+columns are ignored. The password becomes the entry value and url, username
+and note are stored as fields. Rows without a name are named after the host
+of their URL.
+*/
+
+var csvColumns = map[string]string{
+	"name":           "name",
+	"title":          "name",
+	"url":            FieldURL,
+	"login_uri":      FieldURL,
+	"website":        FieldURL,
+	"origin":         FieldURL,
+	"username":       FieldUsername,
+	"login":          FieldUsername,
+	"login_username": FieldUsername,
+	"user":           FieldUsername,
+	"password":       "password",
+	"login_password": "password",
+	"note":           FieldNote,
+	"notes":          FieldNote,
+	"extra":          FieldNote,
+	"comment":        FieldNote,
+}
+
+// ParseCSV reads browser-style CSV credentials.
+func ParseCSV(r io.Reader) ([]Item, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, h := range rows[0] {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if col, ok := csvColumns[h]; ok {
+			if _, dup := columns[col]; !dup {
+				columns[col] = i
+			}
+		}
+	}
+	if _, ok := columns["password"]; !ok {
+		return nil, fmt.Errorf("CSV header has no password column (expected name,url,username,password,note)")
+	}
+
+	var items []Item
+	for _, row := range rows[1:] {
+		get := func(col string) string {
+			if i, ok := columns[col]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		if len(row) == 1 && row[0] == "" {
+			continue
+		}
+		item := Item{Name: strings.TrimSpace(get("name")), Value: get("password"), Fields: make(map[string]string)}
+		for _, field := range []string{FieldURL, FieldUsername, FieldNote} {
+			if value := get(field); value != "" {
+				item.Fields[field] = value
+			}
+		}
+		if item.Name == "" {
+			item.Name = nameFromURL(item.Fields[FieldURL])
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// nameFromURL returns the host of a URL without "www.", or "" if there is none.
+func nameFromURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// FormatCSV writes items in the Chrome layout.
+func FormatCSV(w io.Writer, items []Item) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"name", FieldURL, FieldUsername, "password", FieldNote}); err != nil {
+		return err
+	}
+	for _, item := range items {
+		row := []string{item.Name, item.Fields[FieldURL], item.Fields[FieldUsername], item.Value, item.Fields[FieldNote]}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV imports browser-style CSV credentials, resolving name
+// collisions as opts says, and saves the vault once.
+func (v *Vault) ImportCSV(data []byte, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, err := ParseCSV(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return v.importItems(items, opts, filepath, "CSV")
+}
+
+// ExportCSV writes every entry to path in the Chrome CSV layout, readable
+// only by the owner.
+func (v *Vault) ExportCSV(path string) error {
+	items, err := v.items(false)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := FormatCSV(&buf, items); err != nil {
+		return err
+	}
+	defer wipe(buf.Bytes())
+	if err := WritePrivateFile(path, buf.Bytes()); err != nil {
+		return err
+	}
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries to %s as CSV", len(items), path))
+	return nil
+}
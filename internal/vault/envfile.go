@@ -0,0 +1,335 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+Entries can be written as environment variables for local development:
+
+	dotenv:  DB_PASSWORD="s3cret \$HOME"
+	shell:   export DB_PASSWORD='it'\''s'
+	yaml:    DB_PASSWORD: "s3cret"
+
+Only entry values are written. Names below the prefix become upper-case
+identifiers: every run of characters other than letters, digits and
+underscores turns into one underscore, so "db/api-key" is DB_API_KEY.
+Importing reads the same formats and stores each variable under
+prefix + variable name.
+*/
+
+// Formats accepted by ExportEnv and ImportEnv.
+const (
+	EnvDotenv = "dotenv"
+	EnvShell  = "shell"
+	EnvYAML   = "yaml"
+)
+
+// EnvName converts an entry name to an environment variable name.
+func EnvName(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToUpper(name) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	s := b.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+// envItems returns the entries under prefix with their variable names,
+// sorted by name, and fails if two entries map to the same variable.
+func (v *Vault) envItems(prefix string) ([]Item, error) {
+	var out []Item
+	seen := make(map[string]string)
+	for _, name := range v.Names() {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		variable := EnvName(rest)
+		if other, dup := seen[variable]; dup {
+			return nil, fmt.Errorf("entries '%s' and '%s' would both be written as %s, rename one of them", other, name, variable)
+		}
+		seen[variable] = name
+		value, err := v.Value(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Item{Name: variable, Value: value})
+	}
+	return out, nil
+}
+
+// ExportEnv writes the values of the entries under prefix to w as dotenv,
+// shell or yaml and returns how many were written.
+func (v *Vault) ExportEnv(w io.Writer, format, prefix string) (int, error) {
+	items, err := v.envItems(prefix)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	defer func() { wipe(buf.Bytes()) }()
+	for _, item := range items {
+		switch format {
+		case EnvDotenv:
+			buf.WriteString(item.Name + "=" + dotenvQuote(item.Value) + "\n")
+		case EnvShell:
+			buf.WriteString("export " + item.Name + "=" + shellQuote(item.Value) + "\n")
+		case EnvYAML:
+			buf.WriteString(item.Name + ": " + strconv.Quote(item.Value) + "\n")
+		default:
+			return 0, fmt.Errorf("unknown environment format %q", format)
+		}
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries under %q as %s", len(items), prefix, format))
+	return len(items), nil
+}
+
+// dotenvQuote leaves simple values bare, single-quotes values without
+// quotes or line breaks, and double-quotes the rest with escapes.
+func dotenvQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_./:@,+-") == "" {
+		return s
+	}
+	if !strings.ContainsAny(s, "'\n\r") {
+		return "'" + s + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(s) + `"`
+}
+
+// shellQuote single-quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ParseEnv reads variables in the dotenv, shell or yaml format. Comments,
+// blank lines and "export " prefixes are allowed in all of them.
+func ParseEnv(format string, data []byte) ([]Item, error) {
+	var items []Item
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	lineNo := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNo++
+		return strings.TrimSuffix(scanner.Text(), "\r"), true
+	}
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || (format == EnvYAML && trimmed == "---") {
+			continue
+		}
+		start := lineNo
+		if format == EnvYAML && (line[0] == ' ' || line[0] == '\t') {
+			return nil, fmt.Errorf("line %d: only flat KEY: value pairs are supported", start)
+		}
+
+		sep := "="
+		if format == EnvYAML {
+			sep = ":"
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(trimmed, "export "), sep)
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY%sVALUE", start, sep)
+		}
+
+		var err error
+		switch format {
+		case EnvYAML:
+			value, err = yamlValue(strings.TrimSpace(value))
+		case EnvDotenv, EnvShell:
+			// quoted values may continue on the following lines
+			for {
+				var complete bool
+				var parsed string
+				parsed, complete, err = shellValue(value, format == EnvDotenv)
+				if err != nil || complete {
+					value = parsed
+					break
+				}
+				more, ok := next()
+				if !ok {
+					err = fmt.Errorf("unterminated quote")
+					break
+				}
+				value += "\n" + more
+			}
+		default:
+			return nil, fmt.Errorf("unknown environment format %q", format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", start, key, err)
+		}
+		items = append(items, Item{Name: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// shellValue unquotes a value made of bare, 'single' and "double" quoted
+// parts. In dotenv mode \n, \r and \t in double quotes are line breaks and
+// tabs, as dotenv libraries read them. complete is false if a quote is
+// still open at the end of s.
+func shellValue(s string, dotenv bool) (value string, complete bool, err error) {
+	s = strings.TrimLeft(s, " \t")
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return "", false, nil
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch e := s[i]; {
+					case dotenv && e == 'n':
+						b.WriteByte('\n')
+					case dotenv && e == 'r':
+						b.WriteByte('\r')
+					case dotenv && e == 't':
+						b.WriteByte('\t')
+					case e == '\\' || e == '"' || e == '$' || e == '`':
+						b.WriteByte(e)
+					case e == '\n':
+						// line continuation
+					default:
+						b.WriteByte('\\')
+						b.WriteByte(e)
+					}
+					continue
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return "", false, nil
+			}
+		case c == '\\' && !dotenv && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(b.String(), " \t"), true, nil
+		case c == ' ' || c == '\t':
+			// whitespace ends a shell word, dotenv keeps it inside bare values
+			rest := strings.TrimLeft(s[i:], " \t")
+			if rest == "" || rest[0] == '#' {
+				return b.String(), true, nil
+			}
+			if !dotenv {
+				return "", true, fmt.Errorf("unquoted whitespace in value")
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true, nil
+}
+
+// yamlValue reads a plain, single-quoted or double-quoted YAML scalar.
+func yamlValue(s string) (string, error) {
+	switch {
+	case s == "" || s == "~" || s == "null":
+		return "", nil
+	case s[0] == '"':
+		end := closingDoubleQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected text after the value")
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted value")
+		}
+		return value, nil
+	case s[0] == '\'':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				if rest := strings.TrimSpace(s[i+1:]); rest != "" && rest[0] != '#' {
+					return "", fmt.Errorf("unexpected text after the value")
+				}
+				return b.String(), nil
+			}
+			b.WriteByte(s[i])
+		}
+		return "", fmt.Errorf("unterminated quote")
+	case strings.ContainsAny(s[:1], "|>[{&*!"):
+		return "", fmt.Errorf("only flat KEY: value pairs are supported")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+func closingDoubleQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// ImportEnv imports variables in the dotenv, shell or yaml format as
+// entries named prefix + variable name, resolving name collisions as
+// opts says, and saves the vault once.
+func (v *Vault) ImportEnv(data []byte, format, prefix, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, err := ParseEnv(format, data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Name = prefix + items[i].Name
+	}
+	return v.importItems(items, opts, filepath, format)
+}
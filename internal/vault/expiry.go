@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ExpiryInfo describes when an entry has to be replaced.
+type ExpiryInfo struct {
+	Name    string
+	Due     time.Time
+	Reason  string // "expires" or "rotate"
+	Expired bool
+}
+
+// SetExpiry sets an absolute expiry date and/or a "rotate every N days"
+// policy on an entry and saves the vault. Zero values clear them.
+func (v *Vault) SetExpiry(name string, expires time.Time, rotateDays int, filepath string) error {
+	if !v.Has(name) {
+		return fmt.Errorf("entry with name '%s' doesn't exists", name)
+	}
+	if rotateDays < 0 {
+		return fmt.Errorf("rotation period cannot be negative")
+	}
+	if v.index == nil {
+		v.index = make(map[string]indexEntry)
+	}
+	e := v.index[name]
+	e.Expires = expires
+	e.RotateDays = rotateDays
+	v.index[name] = e
+	return v.Save(filepath)
+}
+
+// Expiry returns when an entry is due, the earlier of its expiry date and
+// its next rotation. ok is false if the entry has neither.
+func (v *Vault) Expiry(name string) (ExpiryInfo, bool) {
+	e, exists := v.index[name]
+	if !exists {
+		return ExpiryInfo{}, false
+	}
+	info := ExpiryInfo{Name: name}
+	if !e.Expires.IsZero() {
+		info.Due, info.Reason = e.Expires, "expires"
+	}
+	if e.RotateDays > 0 && !e.Changed.IsZero() {
+		rotate := e.Changed.AddDate(0, 0, e.RotateDays)
+		if info.Due.IsZero() || rotate.Before(info.Due) {
+			info.Due, info.Reason = rotate, "rotate"
+		}
+	}
+	if info.Due.IsZero() {
+		return ExpiryInfo{}, false
+	}
+	info.Expired = !info.Due.After(v.env().Now())
+	return info, true
+}
+
+// ExpiryPolicy returns the expiry date and rotation period stored on an
+// entry, zero values if they are not set.
+func (v *Vault) ExpiryPolicy(name string) (expires time.Time, rotateDays int) {
+	e := v.index[name]
+	return e.Expires, e.RotateDays
+}
+
+// Expiring returns the entries that are due within the given duration
+// (including the already expired ones), soonest first.
+func (v *Vault) Expiring(within time.Duration) []ExpiryInfo {
+	limit := v.env().Now().Add(within)
+	var out []ExpiryInfo
+	for _, name := range v.Names() {
+		if info, ok := v.Expiry(name); ok && !info.Due.After(limit) {
+			out = append(out, info)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b ExpiryInfo) int { return a.Due.Compare(b.Due) })
+	return out
+}
+
+// Changed returns when the value of an entry was last set, zero if it was
+// never saved.
+func (v *Vault) Changed(name string) time.Time {
+	return v.index[name].Changed
+}
@@ -0,0 +1,316 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+/*
+Vault file layouts:
+
+	legacy: salt(16) | nonce(12) | AES-GCM(PBKDF2(password, salt), gob(map[string]string))
+	v2/v3:  magic(6) | version(1) | headerLen(4) | gob(header) | nonce(12) | AES-GCM(dataKey, gob(payload))
+	v4:     magic(6) | version(1) | headerLen(4) | gob(header) | gob(sealedBody), see records.go
+
+Since v2 the entries are sealed with a random data key. The header carries that
+key wrapped once for the password (if any) and once per X25519 recipient, so
+access can be granted or revoked without re-encrypting for a shared secret.
+
+v3 passes everything before the nonce (magic, version, header length and the
+header itself) to GCM as associated data, so any change to the version, KDF
+parameters, vault ID or key stanzas makes decryption fail with ErrIntegrity.
+v2 files are still read, but a v3 file rewritten as v2 fails the same way
+because its tag was computed over the header. v4 authenticates the header
+the same way through the sealed index.
+*/
+
+const (
+	fileMagic     = "GOPASS"
+	formatVersion = 4
+	prefixSize    = len(fileMagic) + 1 + 4
+	dataKeySize   = 32
+	vaultIDSize   = 16
+	kdfPBKDF2     = "pbkdf2-sha256"
+
+	// maxPBKDF2Iterations keeps a damaged or hostile header from making the
+	// password check run for hours before the header fails to authenticate.
+	maxPBKDF2Iterations = 100 * pbkdf2Iterations
+)
+
+// ErrIntegrity reports a vault file whose header or contents were modified
+// after it was written, as opposed to a wrong password or missing identity.
+var ErrIntegrity = errors.New("vault integrity check failed")
+
+// ErrWrongPassword reports a password that doesn't open the password stanza.
+// Without a key check value it can also mean the stanza itself is damaged.
+var ErrWrongPassword = errors.New("wrong password")
+
+// header is the unencrypted, authenticated part of a vault file.
+type header struct {
+	ID         []byte // random UUID, fixed for the vault's lifetime
+	KDF        string
+	Iterations int
+
+	Salt       []byte // PBKDF2 salt for the password stanza, nil if the vault has no password
+	Password   []byte // data key sealed with the password-derived key (nonce | ciphertext)
+	KeyCheck   []byte // key check value of the password-derived key, nil in older files
+	Recipients []recipientStanza
+}
+
+func newHeader() (*header, error) {
+	h := &header{ID: make([]byte, vaultIDSize), KDF: kdfPBKDF2, Iterations: pbkdf2Iterations}
+	if _, err := rand.Read(h.ID); err != nil {
+		return nil, fmt.Errorf("failed to generate vault id: %v", err)
+	}
+	h.ID[6] = h.ID[6]&0x0f | 0x40 // RFC 4122 version 4
+	h.ID[8] = h.ID[8]&0x3f | 0x80
+	return h, nil
+}
+
+// ID returns the vault's UUID, or an empty string before it was first saved.
+func (v *Vault) ID() string {
+	if v.header == nil {
+		return ""
+	}
+	id := v.header.ID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// checkKDF refuses parameters that would weaken the password stanza or
+// take unreasonably long to derive.
+func (h *header) checkKDF() error {
+	if h.KDF != kdfPBKDF2 {
+		return fmt.Errorf("%w: unknown key derivation %q", ErrIntegrity, h.KDF)
+	}
+	if h.Iterations < pbkdf2Iterations {
+		return fmt.Errorf("%w: key derivation downgraded to %d iterations", ErrIntegrity, h.Iterations)
+	}
+	if h.Iterations > maxPBKDF2Iterations {
+		return fmt.Errorf("%w: key derivation asks for %d iterations", ErrIntegrity, h.Iterations)
+	}
+	return nil
+}
+
+// payload is the gob-encoded plaintext of v2 and v3 vaults.
+type payload struct {
+	Entries map[string]string
+}
+
+func hasMagic(data []byte) bool {
+	return len(data) >= prefixSize && string(data[:len(fileMagic)]) == fileMagic
+}
+
+func newDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+	lockKey(key)
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher block: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM cipher: %v", err)
+	}
+	return gcm, nil
+}
+
+// seal encrypts plaintext with key, authenticating ad, and returns nonce | ciphertext.
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// open reverses seal.
+func open(key, sealed, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceSize {
+		return nil, errors.New("sealed data is too short")
+	}
+	return gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ad)
+}
+
+// keyCheck returns the key check value of a password-derived key. It tells
+// a wrong password apart from a damaged password stanza without revealing
+// more than the stanza itself does.
+func keyCheck(kek []byte) []byte {
+	mac := hmac.New(sha256.New, kek)
+	mac.Write([]byte("gopass key check"))
+	return mac.Sum(nil)[:8]
+}
+
+// wrapWithPassword seals the data key for the password and sets the
+// header's key check value to match.
+func wrapWithPassword(password []byte, h *header, dataKey []byte) ([]byte, error) {
+	kek, err := deriveKeyWith(password, h.Salt, h.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kek)
+	h.KeyCheck = keyCheck(kek)
+	return seal(kek, dataKey, nil)
+}
+
+// unwrapWithPassword opens the password stanza. It fails with
+// ErrWrongPassword for a wrong password and with ErrIntegrity when the key
+// check value proves the password right but the stanza doesn't open.
+func unwrapWithPassword(password []byte, h *header) ([]byte, error) {
+	if h.Salt == nil {
+		return nil, errors.New("vault has no password stanza")
+	}
+	kek, err := deriveKeyWith(password, h.Salt, h.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kek)
+	if h.KeyCheck != nil && !hmac.Equal(keyCheck(kek), h.KeyCheck) {
+		return nil, ErrWrongPassword
+	}
+	dataKey, err := open(kek, h.Password, nil)
+	if err != nil {
+		if h.KeyCheck != nil {
+			return nil, fmt.Errorf("%w: the password is right but its key stanza is damaged", ErrIntegrity)
+		}
+		return nil, ErrWrongPassword
+	}
+	return dataKey, nil
+}
+
+// parsedFile is a versioned vault file split into its parts.
+type parsedFile struct {
+	header  *header
+	version byte
+	ad      []byte // bytes authenticated as associated data, nil for v2
+	body    []byte
+}
+
+// parseFile splits a versioned vault file into its header, the bytes to
+// authenticate as associated data, and the sealed body.
+func parseFile(data []byte) (*parsedFile, error) {
+	if !hasMagic(data) {
+		return nil, errors.New("not a versioned vault file")
+	}
+	version := data[len(fileMagic)]
+	if version < 2 || version > formatVersion {
+		return nil, fmt.Errorf("%w: unsupported vault format version %d", ErrIntegrity, version)
+	}
+	hlen := binary.BigEndian.Uint32(data[len(fileMagic)+1 : prefixSize])
+	if uint64(len(data)-prefixSize) < uint64(hlen)+nonceSize {
+		return nil, fmt.Errorf("%w: vault file is too short or corrupted", ErrIntegrity)
+	}
+	end := prefixSize + int(hlen)
+	var h header
+	if err := gob.NewDecoder(bytes.NewReader(data[prefixSize:end])).Decode(&h); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode vault header: %v", ErrIntegrity, err)
+	}
+
+	var ad []byte
+	if version == 2 {
+		// v2 had no vault id or KDF fields and sealed without associated data
+		h.KDF, h.Iterations = kdfPBKDF2, pbkdf2Iterations
+	} else {
+		if err := h.checkKDF(); err != nil {
+			return nil, err
+		}
+		if len(h.ID) != vaultIDSize {
+			return nil, fmt.Errorf("%w: malformed vault id", ErrIntegrity)
+		}
+		ad = data[:end]
+	}
+	return &parsedFile{header: &h, version: version, ad: ad, body: data[end:]}, nil
+}
+
+// marshal seals pending entries and serializes the vault in the current format.
+func (v *Vault) marshal() ([]byte, error) {
+	if err := v.sealPending(); err != nil {
+		return nil, err
+	}
+	if v.log == nil {
+		if err := v.initLog(); err != nil {
+			return nil, err
+		}
+	}
+	var hbuf bytes.Buffer
+	if err := gob.NewEncoder(&hbuf).Encode(v.header); err != nil {
+		return nil, fmt.Errorf("failed to encode vault header: %v", err)
+	}
+
+	out := make([]byte, 0, prefixSize+hbuf.Len())
+	out = append(out, fileMagic...)
+	out = append(out, formatVersion)
+	out = binary.BigEndian.AppendUint32(out, uint32(hbuf.Len()))
+	out = append(out, hbuf.Bytes()...)
+
+	body, err := v.marshalBody(out)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, body...), nil
+}
+
+// openFile decrypts a parsed file with its data key. v2 and v3 bodies are
+// one blob, their entries come back pending and are sealed per record on the
+// next Save.
+func openFile(f *parsedFile, dataKey []byte) (*Vault, error) {
+	v := &Vault{Entries: make(map[string]string), header: f.header, dataKey: dataKey}
+	if f.header.ID == nil {
+		// upgraded from v2, which had no vault id
+		nh, err := newHeader()
+		if err != nil {
+			return nil, err
+		}
+		f.header.ID = nh.ID
+	}
+	if f.version < 4 {
+		p, err := decodePayload(dataKey, f.body, f.ad)
+		if err != nil {
+			return nil, err
+		}
+		v.Entries = p.Entries
+		return v, nil
+	}
+	if err := v.unmarshalBody(f.body, f.ad); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodePayload(dataKey, body, ad []byte) (*payload, error) {
+	plaintext, err := open(dataKey, body, ad)
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	defer wipe(plaintext)
+	var p payload
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode vault data: %v", err)
+	}
+	if p.Entries == nil {
+		p.Entries = make(map[string]string)
+	}
+	return &p, nil
+}
@@ -0,0 +1,302 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Kinds of problems reported by Fsck.
+const (
+	ProblemTruncated     = "truncated"
+	ProblemBadHeader     = "bad header"
+	ProblemNoKey         = "no key"
+	ProblemWrongPassword = "wrong password"
+	ProblemAuth          = "authentication failed"
+	ProblemDecode        = "decode error"
+	ProblemEntry         = "damaged entry"
+)
+
+// gcmTagSize is the size of the authentication tag at the end of every sealed blob.
+const gcmTagSize = 16
+
+// Problem is one thing wrong with a vault file.
+type Problem struct {
+	Kind   string
+	Detail string
+}
+
+// FsckReport is the result of checking one vault file.
+type FsckReport struct {
+	Path     string
+	ModTime  time.Time
+	Version  int // 1 for legacy files
+	Entries  int // entries that could be read
+	Problems []Problem
+}
+
+// OK reports whether the file opened completely.
+func (r *FsckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *FsckReport) add(kind, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// fsckPassword fetches the vault password once, from the keyring or reader.
+type fsckPassword struct {
+	keyID  string
+	reader PasswordReader
+	value  *string
+}
+
+func (p *fsckPassword) get() (string, error) {
+	if p.value != nil {
+		return *p.value, nil
+	}
+	password, err := keyring.Get(service, p.keyID)
+	if err != nil {
+		if password, err = p.reader.Read("Enter password to check vault: "); err != nil {
+			return "", fmt.Errorf("failed to read password: %v", err)
+		}
+	}
+	p.value = &password
+	return password, nil
+}
+
+// Fsck checks the vault file at filepath without modifying it and reports
+// truncation, a bad header, a wrong password, failed authentication of the
+// key stanza, index or records, and decode errors. The password comes from
+// the keyring or, if it isn't there, from reader. An error is only returned
+// if the file can't be read at all.
+func Fsck(filepath string, reader PasswordReader) (*FsckReport, error) {
+	return fsckFile(filepath, &fsckPassword{keyID: "vault:" + filepath, reader: reader})
+}
+
+// FsckBackups checks every backup of the vault at filepath, newest first,
+// with the vault's own credentials.
+func FsckBackups(filepath string, reader PasswordReader) ([]*FsckReport, error) {
+	pw := &fsckPassword{keyID: "vault:" + filepath, reader: reader}
+	var out []*FsckReport
+	for _, b := range Backups(filepath) {
+		r, err := fsckFile(b.Path, pw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func fsckFile(path string, pw *fsckPassword) (*FsckReport, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &FsckReport{Path: path, ModTime: info.ModTime()}
+	if err := diagnose(r, data, pw); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func diagnose(r *FsckReport, data []byte, pw *fsckPassword) error {
+	if len(data) == 0 {
+		r.add(ProblemTruncated, "the file is empty")
+		return nil
+	}
+	if !hasMagic(data) {
+		return diagnoseLegacy(r, data, pw)
+	}
+
+	r.Version = int(data[len(fileMagic)])
+	if r.Version < 2 || r.Version > formatVersion {
+		r.add(ProblemBadHeader, "unknown format version %d", r.Version)
+		return nil
+	}
+	hlen := binary.BigEndian.Uint32(data[len(fileMagic)+1 : prefixSize])
+	if uint64(len(data)-prefixSize) < uint64(hlen) {
+		r.add(ProblemTruncated, "the header should be %d bytes but the file ends after %d", hlen, len(data)-prefixSize)
+		return nil
+	}
+	f, err := parseFile(data)
+	if err != nil {
+		if len(data)-prefixSize-int(hlen) < nonceSize {
+			r.add(ProblemTruncated, "the file ends right after the header")
+		} else {
+			r.add(ProblemBadHeader, "%v", err)
+		}
+		return nil
+	}
+
+	dataKey, err := fsckUnwrap(r, f.header, pw)
+	if err != nil || dataKey == nil {
+		return err
+	}
+	defer wipe(dataKey)
+
+	if f.version < 4 {
+		if len(f.body) < nonceSize+gcmTagSize {
+			r.add(ProblemTruncated, "the sealed contents are only %d bytes", len(f.body))
+			return nil
+		}
+		p, err := decodePayload(dataKey, f.body, f.ad)
+		switch {
+		case errors.Is(err, ErrIntegrity):
+			r.add(ProblemAuth, "the contents failed authentication, the file was truncated or modified")
+		case err != nil:
+			r.add(ProblemDecode, "%v", err)
+		default:
+			r.Entries = len(p.Entries)
+		}
+		return nil
+	}
+	diagnoseBody(r, f, dataKey)
+	return nil
+}
+
+func diagnoseLegacy(r *FsckReport, data []byte, pw *fsckPassword) error {
+	r.Version = 1
+	if len(data) < saltSize+nonceSize+gcmTagSize {
+		r.add(ProblemTruncated, "the legacy vault file is only %d bytes", len(data))
+		return nil
+	}
+	password, err := pw.get()
+	if err != nil {
+		return err
+	}
+	passBytes := []byte(password)
+	key, err := deriveKey(passBytes, data[:saltSize])
+	wipe(passBytes)
+	if err != nil {
+		return err
+	}
+	defer wipe(key)
+	plaintext, err := open(key, data[saltSize:], nil)
+	if err != nil {
+		r.add(ProblemAuth, "decryption failed: wrong password or damaged file (legacy vaults have no key check value to tell them apart)")
+		return nil
+	}
+	defer wipe(plaintext)
+	var entries map[string]string
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&entries); err != nil {
+		r.add(ProblemDecode, "failed to decode entries: %v", err)
+		return nil
+	}
+	r.Entries = len(entries)
+	return nil
+}
+
+// fsckUnwrap recovers the data key like Load does, recording why it can't.
+func fsckUnwrap(r *FsckReport, h *header, pw *fsckPassword) ([]byte, error) {
+	if id := localIdentity(); id != nil {
+		for _, s := range h.Recipients {
+			if k, err := id.unwrap(s); err == nil {
+				return k, nil
+			}
+		}
+	}
+	if h.Salt == nil {
+		r.add(ProblemNoKey, "the vault has no password and no local identity matches its recipients")
+		return nil, nil
+	}
+	password, err := pw.get()
+	if err != nil {
+		return nil, err
+	}
+	passBytes := []byte(password)
+	dataKey, err := unwrapWithPassword(passBytes, h)
+	wipe(passBytes)
+	switch {
+	case err == nil:
+		return dataKey, nil
+	case errors.Is(err, ErrIntegrity):
+		r.add(ProblemAuth, "the password matches the key check value but the password stanza failed authentication")
+	case h.KeyCheck != nil:
+		r.add(ProblemWrongPassword, "the password doesn't match the key check value")
+	default:
+		r.add(ProblemWrongPassword, "the password stanza didn't open: wrong password or damaged stanza (this file has no key check value)")
+	}
+	return nil, nil
+}
+
+func diagnoseBody(r *FsckReport, f *parsedFile, dataKey []byte) {
+	var sb sealedBody
+	if err := gob.NewDecoder(bytes.NewReader(f.body)).Decode(&sb); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			r.add(ProblemTruncated, "the body ends early: %v", err)
+		} else {
+			r.add(ProblemDecode, "failed to decode the body: %v", err)
+		}
+		return
+	}
+
+	v := &Vault{header: f.header, dataKey: dataKey, records: sb.Records}
+	key, err := v.subkey("gopass index")
+	if err != nil {
+		r.add(ProblemAuth, "%v", err)
+		return
+	}
+	plaintext, err := open(key, sb.Index, f.ad)
+	wipe(key)
+	if err != nil {
+		r.add(ProblemAuth, "the index failed authentication, the header or index was modified")
+		return
+	}
+	defer wipe(plaintext)
+	var idx index
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&idx); err != nil {
+		r.add(ProblemDecode, "failed to decode the index: %v", err)
+		return
+	}
+
+	check := func(label string, e indexEntry) bool {
+		ok := true
+		if value, err := v.openSealed(e.Record, e.Digest); err != nil {
+			r.add(ProblemEntry, "%s: %v", label, err)
+			ok = false
+		} else {
+			var rec record
+			if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&rec); err != nil {
+				r.add(ProblemEntry, "%s: failed to decode: %v", label, err)
+				ok = false
+			}
+			wipe(value)
+		}
+		for _, file := range slices.Sorted(maps.Keys(e.Attachments)) {
+			a := e.Attachments[file]
+			content, err := v.openSealed(a.Record, a.Digest)
+			if err != nil {
+				r.add(ProblemEntry, "%s: attachment %s: %v", label, file, err)
+				ok = false
+				continue
+			}
+			wipe(content)
+		}
+		return ok
+	}
+	for _, name := range slices.Sorted(maps.Keys(idx.Entries)) {
+		if check(name, idx.Entries[name]) {
+			r.Entries++
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(idx.Trash)) {
+		for _, t := range idx.Trash[name] {
+			check(name+" (in trash)", t.Entry)
+		}
+	}
+}
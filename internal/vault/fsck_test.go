@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func hasProblem(r *FsckReport, kind string) bool {
+	for _, p := range r.Problems {
+		if p.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// flip returns a copy of data with one byte inside the first occurrence of
+// part changed.
+func flip(t *testing.T, data, part []byte) []byte {
+	t.Helper()
+	i := bytes.Index(data, part)
+	if i < 0 {
+		t.Fatal("part not found in vault file")
+	}
+	out := bytes.Clone(data)
+	out[i+len(part)-1] ^= 0x01
+	return out
+}
+
+func TestFsck(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "fsck.dat")
+	_ = keyring.Set(service, "vault:"+path, "pw")
+
+	v := &Vault{Entries: map[string]string{"aws": "key1", "gcp": "key2"}}
+	if err := v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	good, _ := os.ReadFile(path)
+	reader := StaticPasswordReader{}
+
+	r, err := Fsck(path, reader)
+	if err != nil || !r.OK() || r.Entries != 2 || r.Version != formatVersion {
+		t.Fatalf("healthy vault reported %+v (%v)", r, err)
+	}
+
+	var record []byte
+	for _, sealed := range v.records {
+		record = sealed
+		break
+	}
+	cases := []struct {
+		name string
+		data []byte
+		kind string
+	}{
+		{"empty", nil, ProblemTruncated},
+		{"cut in header", good[:prefixSize+4], ProblemTruncated},
+		{"cut in body", good[:len(good)-20], ProblemTruncated},
+		{"bad version", append(append([]byte(fileMagic), 9), good[len(fileMagic)+1:]...), ProblemBadHeader},
+		{"damaged stanza", flip(t, good, v.header.Password), ProblemAuth},
+		{"damaged record", flip(t, good, record), ProblemEntry},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(path, c.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		r, err := Fsck(path, reader)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !hasProblem(r, c.kind) {
+			t.Errorf("%s: expected %q, got %+v", c.name, c.kind, r.Problems)
+		}
+	}
+
+	// the key check value lets Load fail fast instead of asking again
+	_ = os.WriteFile(path, flip(t, good, v.header.Password), 0o600)
+	if _, err := LoadWithReader(path, reader); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("damaged stanza should fail the integrity check, got %v", err)
+	}
+
+	_ = os.WriteFile(path, good, 0o600)
+	_ = keyring.Set(service, "vault:"+path, "not the password")
+	if r, _ := Fsck(path, reader); !hasProblem(r, ProblemWrongPassword) {
+		t.Errorf("expected a wrong password, got %+v", r.Problems)
+	}
+	_ = keyring.Set(service, "vault:"+path, "pw")
+}
+
+func TestBackupsAndRestore(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "backups.dat")
+	_ = keyring.Set(service, "vault:"+path, "pw")
+
+	v := &Vault{Entries: map[string]string{"aws": "key1"}}
+	for range defaultBackups + 2 {
+		if err := v.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups := Backups(path)
+	if len(backups) != defaultBackups {
+		t.Fatalf("expected %d backups, got %d", defaultBackups, len(backups))
+	}
+	if info, _ := os.Stat(backups[0].Path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("backup mode %v, want 0600", info.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(path)
+	_ = os.WriteFile(path, data[:len(data)/2], 0o600)
+	reports, err := FsckBackups(path, StaticPasswordReader{})
+	if err != nil || len(reports) != defaultBackups || !reports[0].OK() {
+		t.Fatalf("backups should check out, got %v (%v)", reports, err)
+	}
+	damaged, err := RestoreBackup(path, reports[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(damaged, ".damaged-") {
+		t.Fatalf("damaged file kept as %q", damaged)
+	}
+	if r, err := Fsck(path, StaticPasswordReader{}); err != nil || !r.OK() {
+		t.Fatalf("restored vault reported %+v (%v)", r, err)
+	}
+	if _, err := os.Stat(damaged); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,354 @@
+package vault
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prozod/gopass/internal/kdbx"
+)
+
+// The fuzz targets feed hostile bytes to everything that parses a file:
+// the vault format before and after decryption, and every import format.
+// Parsers may reject anything, but must not panic, and whatever an importer
+// accepts must survive a save and reload unchanged.
+
+var fuzzKey = bytes.Repeat([]byte{0x42}, dataKeySize)
+
+// fuzzVault returns a vault with a fixed data key and one entry, so imports
+// also run into name collisions. Its Save only stages changes.
+func fuzzVault(t testing.TB) *Vault {
+	h, err := newHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Vault{Entries: map[string]string{"existing": "value"}, header: h, dataKey: append([]byte{}, fuzzKey...)}
+	v.SetIO(IO{Out: &bytes.Buffer{}, Now: func() time.Time { return time.Unix(1700000000, 0) }})
+	v.Begin()
+	return v
+}
+
+// reopen writes v in the file format and reads it back with its key.
+func reopen(t testing.TB, v *Vault) *Vault {
+	data, err := v.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parseFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openFile(f, v.dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.io = v.io
+	return r
+}
+
+// walk reads everything a command could read from v.
+func walk(v *Vault) {
+	for _, name := range v.Names() {
+		_, _ = v.Value(name)
+		fields, _ := v.FieldNames(name)
+		for _, field := range fields {
+			_, _ = v.Field(name, field)
+		}
+		files, _ := v.Attachments(name)
+		for _, file := range files {
+			_, _ = v.Attachment(name, file.Name)
+		}
+		v.Expiry(name)
+	}
+	v.Trash()
+	v.Expiring(24 * time.Hour)
+	_, _ = v.items(true)
+}
+
+// checkImport runs an importer on a fuzz vault and checks that everything
+// it added comes back the same after a save and reload.
+func checkImport(t *testing.T, imp func(v *Vault, opts ImportOptions) (*ImportReport, error)) {
+	v := fuzzVault(t)
+	if _, err := imp(v, ImportOptions{Policy: ConflictRename}); err != nil {
+		return
+	}
+	want, err := v.items(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopen(t, v).items(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d entries came back, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Value != want[i].Value || len(got[i].Fields) != len(want[i].Fields) || len(got[i].Files) != len(want[i].Files) {
+			t.Fatalf("entry %q came back as %+v, want %+v", want[i].Name, got[i], want[i])
+		}
+		for field, value := range want[i].Fields {
+			if got[i].Fields[field] != value {
+				t.Fatalf("field %s of %q came back as %q, want %q", field, want[i].Name, got[i].Fields[field], value)
+			}
+		}
+		for file, content := range want[i].Files {
+			if !bytes.Equal(got[i].Files[file], content) {
+				t.Fatalf("attachment %s of %q changed", file, want[i].Name)
+			}
+		}
+	}
+}
+
+func FuzzParseFile(f *testing.F) {
+	v := fuzzVault(f)
+	_ = v.stage("github", "token", map[string]string{FieldUsername: "me"})
+	v.addPendingFile("github", "key", []byte{0, 1, 2})
+	if err := v.moveToTrash("existing", ""); err != nil {
+		f.Fatal(err)
+	}
+	data, err := v.marshal()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Add(data[:prefixSize+10])
+	f.Add([]byte(fileMagic + "\x04\xff\xff\xff\xff"))
+	f.Add([]byte(fileMagic + "\x02\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pf, err := parseFile(data)
+		if err != nil {
+			return
+		}
+		if v, err := openFile(pf, fuzzKey); err == nil {
+			walk(v)
+		}
+	})
+}
+
+func FuzzLegacy(f *testing.F) {
+	var buf bytes.Buffer
+	_ = gob.NewEncoder(&buf).Encode(map[string]string{"gmail": "pass123", "": ""})
+	f.Add(buf.Bytes())
+	f.Add(make([]byte, saltSize+nonceSize))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if salt, nonce, ciphertext, err := splitLegacy(data); err == nil {
+			if len(salt) != saltSize || len(nonce) != nonceSize || len(ciphertext) != len(data)-saltSize-nonceSize {
+				t.Fatalf("split %d bytes into %d, %d and %d", len(data), len(salt), len(nonce), len(ciphertext))
+			}
+		}
+		if entries, err := decodeLegacy(data); err == nil && entries == nil {
+			t.Fatal("decoded nil entries")
+		}
+	})
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	var buf bytes.Buffer
+	_ = gob.NewEncoder(&buf).Encode(payload{Entries: map[string]string{"gmail": "pass123"}})
+	f.Add(buf.Bytes())
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, plaintext []byte) {
+		ad := []byte("header")
+		sealed, err := seal(fuzzKey, plaintext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, err := decodePayload(fuzzKey, sealed, ad); err == nil && p.Entries == nil {
+			t.Fatal("decoded nil entries")
+		}
+	})
+}
+
+// FuzzIndex decodes an arbitrary index as if it had decrypted correctly.
+func FuzzIndex(f *testing.F) {
+	v := fuzzVault(f)
+	_ = v.stage("github", "token", map[string]string{FieldOTP: "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP"})
+	_ = v.SetExpiry("github", time.Unix(1800000000, 0), 30, "")
+	_ = v.moveToTrash("existing", "")
+	if err := v.initLog(); err != nil {
+		f.Fatal(err)
+	}
+	if err := v.sealPending(); err != nil {
+		f.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(index{Entries: v.index, Trash: v.trash, Log: v.log}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	records := v.records
+	f.Fuzz(func(t *testing.T, plaintext []byte) {
+		v := fuzzVault(t)
+		key, err := v.subkey("gopass index")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ad := []byte("header")
+		sealed, err := seal(key, plaintext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		if err := gob.NewEncoder(&body).Encode(sealedBody{Index: sealed, Records: records}); err != nil {
+			t.Fatal(err)
+		}
+		v.Entries = nil
+		if err := v.unmarshalBody(body.Bytes(), ad); err == nil {
+			walk(v)
+		}
+	})
+}
+
+// FuzzRecord decodes an arbitrary record as if it had decrypted correctly.
+func FuzzRecord(f *testing.F) {
+	var buf bytes.Buffer
+	_ = gob.NewEncoder(&buf).Encode(record{Value: "token", Fields: map[string]string{FieldUsername: "me"}})
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, plaintext []byte) {
+		v := fuzzVault(t)
+		v.Entries = nil
+		key, err := v.subkey("gopass record")
+		if err != nil {
+			t.Fatal(err)
+		}
+		const id = "0123456789abcdef0123456789abcdef"
+		sealed, err := seal(key, plaintext, v.recordAD(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256(sealed)
+		v.index = map[string]indexEntry{"x": {Record: id, Digest: digest[:]}}
+		v.records = map[string][]byte{id: sealed}
+		walk(v)
+	})
+}
+
+func FuzzImportJSON(f *testing.F) {
+	f.Add([]byte(`{"gmail": "pass123", "existing": "other", "": "x", "empty": ""}`))
+	f.Add([]byte(`{"nested": {"a": "b"}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.Import(data, "", opts)
+		})
+	})
+}
+
+func FuzzImportCSV(f *testing.F) {
+	f.Add([]byte("name,url,username,password,note\ngithub,https://github.com,me,token,\"multi\nline\"\n"))
+	f.Add([]byte("url,username,password\nhttps://www.example.org/login,me,pw\n"))
+	f.Add([]byte("\xef\xbb\xbftitle,password,otpauth\nexisting,pw,otpauth://totp/x?secret=AB\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.ImportCSV(data, "", opts)
+		})
+	})
+}
+
+func FuzzImportBitwarden(f *testing.F) {
+	f.Add([]byte(`{"encrypted": false, "folders": [{"id": "f1", "name": "Email"}], "items": [
+	  {"type": 1, "name": "gmail", "folderId": "f1", "fields": [{"name": "pin", "value": "1234", "type": 1}],
+	   "login": {"username": "me", "password": "pw1", "totp": "jbsw y3dp", "uris": [{"uri": "https://mail.google.com"}]}},
+	  {"type": 2, "name": "wifi", "notes": "guest", "secureNote": {"type": 0}},
+	  {"type": 1, "name": "", "login": {"password": "pw2", "totp": "steam://ABC", "uris": [{"uri": "https://example.org"}]}},
+	  {"type": 3, "name": "visa", "card": {"number": "4111"}}]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.ImportBitwarden(data, "", opts)
+		})
+	})
+}
+
+func FuzzImport1Password(f *testing.F) {
+	export := `{"accounts": [{"attrs": {"name": "me"}, "vaults": [{"attrs": {"name": "Personal"}, "items": [
+	  {"state": "active", "categoryUuid": "001",
+	   "details": {"loginFields": [{"value": "me", "designation": "username"}, {"value": "pw1", "designation": "password"}],
+	               "sections": [{"title": "", "fields": [{"title": "otp", "id": "TOTP_1", "value": {"totp": "otpauth://totp/x?secret=AB"}},
+	                 {"title": "expires", "id": "d", "value": {"date": 1700000000}}]}]},
+	   "overview": {"title": "GitHub", "url": "https://github.com"}},
+	  {"state": "active", "categoryUuid": "005", "details": {"password": "router-pw"}, "overview": {"title": "router"}},
+	  {"state": "archived", "categoryUuid": "001", "details": {}, "overview": {"title": "old"}}]}]}]}`
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("export.attributes")
+	_, _ = w.Write([]byte(`{"version": 3}`))
+	w, _ = zw.Create("export.data")
+	_, _ = w.Write([]byte(export))
+	if err := zw.Close(); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.Import1Password(data, "", opts)
+		})
+	})
+}
+
+func FuzzImportEnv(f *testing.F) {
+	f.Add(EnvDotenv, []byte("# comment\nexport API_KEY='it''s'\nDB=\"multi\nline\"\nEMPTY=\n"), "")
+	f.Add(EnvShell, []byte("export TOKEN='a'\\''b'\nPLAIN=value\n"), "app")
+	f.Add(EnvYAML, []byte("\ufeffAPI_KEY: \"quoted\\n\"\nNAME: plain\n  nested: no\n"), "app/prod")
+	f.Fuzz(func(t *testing.T, format string, data []byte, prefix string) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.ImportEnv(data, format, prefix, "", opts)
+		})
+	})
+}
+
+func FuzzImportPassEntry(f *testing.F) {
+	f.Add("web/github", []byte("token\nlogin: me\nurl: https://github.com\notpauth://totp/x?secret=AB\nfree text\n"))
+	f.Add("", []byte(""))
+	f.Fuzz(func(t *testing.T, name string, content []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.importItems([]Item{ParsePassEntry(name, content)}, opts, "", "pass")
+		})
+	})
+}
+
+func FuzzImportKDBX(f *testing.F) {
+	old := kdbx.ExportKDF
+	f.Cleanup(func() { kdbx.ExportKDF = old })
+	kdbx.ExportKDF = kdbx.Argon2Params{Memory: 8 << 10, Iterations: 1, Parallelism: 1}
+	key := kdbx.Key{Password: []byte("pw")}
+	data, err := kdbx.Encode(&kdbx.Database{Entries: []kdbx.Entry{
+		{Title: "mail", Group: []string{"Web"}, Fields: map[string]string{kdbx.FieldUserName: "me", kdbx.FieldPassword: "pw"}},
+		{Fields: map[string]string{kdbx.FieldURL: "https://example.org", kdbx.FieldPassword: "x"}, Files: map[string][]byte{"a": {1}}},
+	}}, key)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.ImportKDBX(data, key, "", opts)
+		})
+	})
+}
+
+func FuzzImportBundle(f *testing.F) {
+	dir := f.TempDir()
+	f.Setenv(identityEnv, filepath.Join(dir, "no-identity"))
+	v := fuzzVault(f)
+	_ = v.stage("github", "token", map[string]string{FieldUsername: "me"})
+	v.addPendingFile("github", "key", []byte{0, 1, 2})
+	path := filepath.Join(dir, "seed.gpb")
+	if err := v.ExportBundle(path, "pw", nil); err != nil {
+		f.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkImport(t, func(v *Vault, opts ImportOptions) (*ImportReport, error) {
+			return v.ImportBundle(data, StaticPasswordReader{Password: "pw"}, "", opts)
+		})
+	})
+}
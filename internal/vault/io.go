@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// Clipboard receives the values Get copies.
+type Clipboard interface {
+	WriteAll(text string) error
+}
+
+type systemClipboard struct{}
+
+func (systemClipboard) WriteAll(text string) error {
+	return clipboard.WriteAll(text)
+}
+
+// IO is how a vault reaches the outside world. Vault operations never print
+// results, they return them; Out only gets warnings about things that
+// didn't make an operation fail. Fields left nil use the process: stderr,
+// the system clipboard, the terminal and time.Now.
+type IO struct {
+	Out       io.Writer
+	Clipboard Clipboard
+	Prompt    PasswordReader // passwords the keyring doesn't have
+	Now       func() time.Time
+}
+
+func (x IO) withDefaults() IO {
+	if x.Out == nil {
+		x.Out = os.Stderr
+	}
+	if x.Clipboard == nil {
+		x.Clipboard = systemClipboard{}
+	}
+	if x.Prompt == nil {
+		x.Prompt = TerminalPasswordReader{}
+	}
+	if x.Now == nil {
+		x.Now = time.Now
+	}
+	return x
+}
+
+// SetIO replaces how the vault reaches the outside world.
+func (v *Vault) SetIO(x IO) {
+	v.io = x
+}
+
+// IO returns how the vault reaches the outside world, with the defaults
+// filled in, for callers that copy or timestamp things on its behalf.
+func (v *Vault) IO() IO {
+	return v.env()
+}
+
+// env returns the vault's IO with the defaults filled in.
+func (v *Vault) env() IO {
+	return v.io.withDefaults()
+}
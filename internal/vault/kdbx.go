@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prozod/gopass/internal/kdbx"
+)
+
+/*
+KeePass groups map to name prefixes: the entry "outlook" in the group
+Email/Work becomes "Email/Work/outlook". The password is the entry value,
+UserName, URL and Notes become the username, url and note fields, the "otp"
+field of KeePassXC becomes otpauth, other strings are kept as fields with
+their KeePass name, and attachments come along up to the vault's attachment limit.
+Entries in the recycle bin and entry history are not imported.
+*/
+
+var kdbxFields = map[string]string{
+	kdbx.FieldUserName: FieldUsername,
+	kdbx.FieldURL:      FieldURL,
+	kdbx.FieldNotes:    FieldNote,
+	"otp":              FieldOTP,
+}
+
+// ImportKDBX imports a KeePass KDBX 4 database, resolving name collisions
+// as opts says, and saves the vault once.
+func (v *Vault) ImportKDBX(data []byte, key kdbx.Key, filepath string, opts ImportOptions) (*ImportReport, error) {
+	db, err := kdbx.Decode(data, key)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, e := range db.Entries {
+		item := Item{Value: e.Fields[kdbx.FieldPassword], Fields: make(map[string]string), Files: e.Files}
+		for field, value := range e.Fields {
+			if field == kdbx.FieldPassword || value == "" {
+				continue
+			}
+			if name, ok := kdbxFields[field]; ok {
+				field = name
+			}
+			item.Fields[field] = value
+		}
+		title := e.Title
+		if title == "" {
+			title = nameFromURL(item.Fields[FieldURL])
+		}
+		if title != "" {
+			item.Name = strings.Join(append(e.Group, title), "/")
+		}
+		items = append(items, item)
+	}
+	return v.importItems(items, opts, filepath, "KeePass")
+}
+
+// ExportKDBX writes every entry with its fields and attachments to a new
+// KDBX 4 database at path, protected by key.
+func (v *Vault) ExportKDBX(path string, key kdbx.Key) error {
+	items, err := v.items(true)
+	if err != nil {
+		return err
+	}
+	db := &kdbx.Database{Name: "gopass"}
+	for _, item := range items {
+		e := kdbx.Entry{Fields: map[string]string{kdbx.FieldPassword: item.Value}, Files: item.Files}
+		parts := strings.Split(item.Name, "/")
+		e.Group, e.Title = parts[:len(parts)-1], parts[len(parts)-1]
+		for field, value := range item.Fields {
+			for kf, name := range kdbxFields {
+				if name == field {
+					field = kf
+					break
+				}
+			}
+			e.Fields[field] = value
+		}
+		db.Entries = append(db.Entries, e)
+	}
+	data, err := kdbx.Encode(db, key)
+	if err != nil {
+		return err
+	}
+	if err := WritePrivateFile(path, data); err != nil {
+		return err
+	}
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries to %s as KeePass", len(items), path))
+	return nil
+}
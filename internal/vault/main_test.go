@@ -0,0 +1,25 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// TestMain keeps every test away from the real keyring, home directory and
+// identity.
+func TestMain(m *testing.M) {
+	keyring.MockInit()
+	home, err := os.MkdirTemp("", "gopass-test-home")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+	os.Unsetenv(identityEnv)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
@@ -0,0 +1,99 @@
+package vault
+
+import "sync"
+
+/*
+Secret material is kept in byte slices that are wiped as soon as they are no
+longer needed: derived keys, unwrapped stanza keys and decrypted buffers.
+Long-lived keys are mlock'd where the OS allows it, so they are not swapped
+out, and core dumps are disabled while any vault is open. Values handed out
+as Go strings (Value, the keyring password) can't be wiped, that's a limit of
+the language.
+*/
+
+// secretHook, when set, sees every short-lived secret buffer. Tests use it to
+// check the buffers are zero once Load and Save return.
+var secretHook func([]byte)
+
+// newSecret allocates a buffer for short-lived secret material.
+// The caller must wipe it.
+func newSecret(n int) []byte {
+	b := make([]byte, n)
+	if secretHook != nil {
+		secretHook(b)
+	}
+	return b
+}
+
+// wipe overwrites secret material with zeros.
+func wipe(b []byte) {
+	clear(b)
+}
+
+// lockKey keeps a long-lived key out of swap, ignoring failures from
+// platforms or limits that don't allow it.
+func lockKey(b []byte) {
+	if len(b) > 0 {
+		_ = mlock(b)
+	}
+}
+
+// releaseKey wipes and unlocks a key locked with lockKey.
+func releaseKey(b []byte) {
+	wipe(b)
+	if len(b) > 0 {
+		_ = munlock(b)
+	}
+}
+
+var (
+	openMu     sync.Mutex
+	openVaults int
+	restoreRes func()
+)
+
+// vaultOpened disables core dumps when the first vault is opened.
+func vaultOpened() {
+	openMu.Lock()
+	defer openMu.Unlock()
+	if openVaults == 0 {
+		restoreRes = disableCoreDumps()
+	}
+	openVaults++
+}
+
+// vaultClosed restores the core dump limit when the last vault is closed.
+func vaultClosed() {
+	openMu.Lock()
+	defer openMu.Unlock()
+	if openVaults == 0 {
+		return
+	}
+	openVaults--
+	if openVaults == 0 && restoreRes != nil {
+		restoreRes()
+		restoreRes = nil
+	}
+}
+
+// Close wipes the vault's key and any unsaved plaintext. The vault can't be
+// read or saved afterwards.
+func (v *Vault) Close() {
+	if v.dataKey == nil {
+		return
+	}
+	releaseKey(v.dataKey)
+	v.dataKey = nil
+	if v.log != nil {
+		releaseKey(v.log.Key)
+	}
+	clear(v.Entries)
+	clear(v.pending)
+	for _, files := range v.pendingFiles {
+		for _, content := range files {
+			wipe(content)
+		}
+	}
+	clear(v.pendingFiles)
+	vaultClosed()
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package vault
+
+func mlock(b []byte) error { return nil }
+
+func munlock(b []byte) error { return nil }
+
+func disableCoreDumps() func() { return func() {} }
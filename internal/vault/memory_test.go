@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// trackSecrets records every short-lived secret buffer allocated until the
+// test ends. The returned function fails the test if any of them still holds
+// non-zero bytes.
+func trackSecrets(t *testing.T) func() {
+	t.Helper()
+	var buffers [][]byte
+	secretHook = func(b []byte) { buffers = append(buffers, b) }
+	t.Cleanup(func() { secretHook = nil })
+
+	return func() {
+		t.Helper()
+		if len(buffers) == 0 {
+			t.Fatal("no secret buffers were allocated")
+		}
+		for i, b := range buffers {
+			if !isZero(b) {
+				t.Errorf("secret buffer %d (%d bytes) was not wiped", i, len(b))
+			}
+		}
+		buffers = nil
+	}
+}
+
+func isZero(b []byte) bool {
+	return bytes.Count(b, []byte{0}) == len(b)
+}
+
+func TestSecretsWipedAfterSaveAndLoad(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "wipe.dat")
+	_ = keyring.Set(service, "vault:"+path, "hunter2")
+
+	assertWiped := trackSecrets(t)
+	v := &Vault{Entries: map[string]string{"a": "1", "b": "2"}}
+	if err := v.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	assertWiped()
+
+	loaded, err := LoadWithReader(path, StaticPasswordReader{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	assertWiped()
+
+	if value, err := loaded.Value("a"); err != nil || value != "1" {
+		t.Fatalf("expected '1', got %q (%v)", value, err)
+	}
+	if err := loaded.Save(path); err != nil {
+		t.Fatalf("save loaded vault: %v", err)
+	}
+	assertWiped()
+
+	dataKey, logKey := loaded.dataKey, loaded.log.Key
+	loaded.Close()
+	if !isZero(dataKey) {
+		t.Fatal("data key was not wiped by Close")
+	}
+	if !isZero(logKey) {
+		t.Fatal("audit log key was not wiped by Close")
+	}
+}
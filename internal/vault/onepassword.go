@@ -0,0 +1,203 @@
+package vault
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+/*
+A 1Password .1pux file is a zip archive whose export.data holds every
+account, vault and item as JSON. Logins, passwords and secure notes are
+imported with the vault name as prefix: the designated username and password
+login fields, the website and the notes map to the usual fields (a secure
+note's text is also its value), and text,
+concealed, URL and email fields from the item's sections keep their title.
+One-time password fields become the entry's OTP. Other categories and
+archived items are reported as unsupported.
+*/
+
+type onePuxExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePuxItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePuxItem struct {
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+	} `json:"overview"`
+}
+
+const (
+	onePuxLogin      = "001"
+	onePuxSecureNote = "003"
+	onePuxPassword   = "005"
+)
+
+var onePuxCategories = map[string]string{
+	"002": "credit card", "004": "identity", "006": "document", "100": "software license",
+	"101": "bank account", "102": "database", "103": "driver license", "104": "outdoor license",
+	"105": "membership", "106": "passport", "107": "reward program", "108": "social security number",
+	"109": "wireless router", "110": "server", "111": "email account", "112": "API credential",
+	"113": "medical record", "114": "SSH key", "115": "crypto wallet",
+}
+
+// maxOnePuxData bounds export.data, which is read into memory.
+const maxOnePuxData = 256 << 20
+
+// Parse1PUX reads a 1Password .1pux export. Items that can't be stored are
+// described in unsupported instead.
+func Parse1PUX(data []byte) (items []Item, unsupported []string, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid 1PUX file: %w", err)
+	}
+	f, err := zr.Open("export.data")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid 1PUX file: %w", err)
+	}
+	raw, err := io.ReadAll(io.LimitReader(f, maxOnePuxData))
+	f.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid 1PUX file: %w", err)
+	}
+	var export onePuxExport
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, nil, fmt.Errorf("invalid 1PUX export data: %w", err)
+	}
+
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, op := range vault.Items {
+				name := joinName(vault.Attrs.Name, op.Overview.Title)
+				switch {
+				case op.State == "archived":
+					unsupported = append(unsupported, name+" (archived)")
+					continue
+				case op.CategoryUUID != onePuxLogin && op.CategoryUUID != onePuxPassword && op.CategoryUUID != onePuxSecureNote:
+					kind, ok := onePuxCategories[op.CategoryUUID]
+					if !ok {
+						kind = "category " + op.CategoryUUID
+					}
+					unsupported = append(unsupported, fmt.Sprintf("%s (%s)", name, kind))
+					continue
+				}
+				item, problems := onePuxToItem(op, vault.Attrs.Name)
+				unsupported = append(unsupported, problems...)
+				items = append(items, item)
+			}
+		}
+	}
+	return items, unsupported, nil
+}
+
+func onePuxToItem(op onePuxItem, vaultName string) (Item, []string) {
+	item := Item{Value: op.Details.Password, Fields: make(map[string]string)}
+	for _, f := range op.Details.LoginFields {
+		switch f.Designation {
+		case "username":
+			item.Fields[FieldUsername] = f.Value
+		case "password":
+			item.Value = f.Value
+		}
+	}
+	item.Fields[FieldURL] = op.Overview.URL
+	if item.Fields[FieldURL] == "" && len(op.Overview.URLs) > 0 {
+		item.Fields[FieldURL] = op.Overview.URLs[0].URL
+	}
+	item.Fields[FieldNote] = op.Details.NotesPlain
+	if op.CategoryUUID == onePuxSecureNote {
+		item.Value = op.Details.NotesPlain
+	}
+
+	title := op.Overview.Title
+	if title == "" {
+		title = nameFromURL(item.Fields[FieldURL])
+	}
+	if title != "" {
+		item.Name = joinName(vaultName, title)
+	}
+
+	var problems []string
+	for _, section := range op.Details.Sections {
+		for _, f := range section.Fields {
+			label := f.Title
+			if label == "" {
+				label = f.ID
+			}
+			for kind, raw := range f.Value {
+				var s string
+				switch kind {
+				case "totp":
+					if json.Unmarshal(raw, &s) != nil || s == "" {
+						continue
+					}
+					uri, err := otpURI(s, title)
+					if err != nil {
+						problems = append(problems, fmt.Sprintf("%s: TOTP seed (%v)", item.Name, err))
+						continue
+					}
+					item.Fields[FieldOTP] = uri
+				case "string", "concealed", "url":
+					if json.Unmarshal(raw, &s) == nil && label != "" {
+						item.Fields[label] = s
+					}
+				case "email":
+					var email struct {
+						Address string `json:"email_address"`
+					}
+					if json.Unmarshal(raw, &email) == nil && label != "" {
+						item.Fields[label] = email.Address
+					}
+				}
+			}
+		}
+	}
+	dropEmpty(item.Fields)
+	return item, problems
+}
+
+// Import1Password imports a 1Password .1pux export, resolving name
+// collisions as opts says, and saves the vault once.
+func (v *Vault) Import1Password(data []byte, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, unsupported, err := Parse1PUX(data)
+	if err != nil {
+		return nil, err
+	}
+	report, err := v.importItems(items, opts, filepath, "1Password")
+	if err != nil {
+		return nil, err
+	}
+	report.Unsupported = unsupported
+	return report, nil
+}
@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prozod/gopass/internal/totp"
+)
+
+// FieldOTP is the entry field holding an otpauth:// URI.
+const FieldOTP = "otpauth"
+
+// SetOTP validates an otpauth:// URI and stores it on an existing entry.
+func (v *Vault) SetOTP(name, uri, filepath string) error {
+	if _, err := totp.ParseURI(uri); err != nil {
+		return err
+	}
+	return v.SetField(name, FieldOTP, uri, filepath)
+}
+
+// OTP returns the TOTP code of an entry valid at the given time and how long
+// it stays valid, and logs the read.
+func (v *Vault) OTP(name string, at time.Time) (string, time.Duration, error) {
+	uri, err := v.Field(name, FieldOTP)
+	if err != nil {
+		return "", 0, fmt.Errorf("'%s' has no OTP seed, store one with 'gopass otp -set <otpauth uri> %s'", name, name)
+	}
+	key, err := totp.ParseURI(uri)
+	if err != nil {
+		return "", 0, err
+	}
+	code, remaining, err := key.Code(at)
+	if err != nil {
+		return "", 0, err
+	}
+	v.logEvent(v.path, "otp", name, "")
+	return code, remaining, nil
+}
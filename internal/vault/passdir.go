@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/*
+pass (password-store) keeps one file per entry in a directory tree, named
+after the entry: Email/gmail.gpg holds the secret for "Email/gmail". The
+file is usually encrypted with gpg and its plaintext has the password on the
+first line, then "key: value" lines and free text:
+
+	hunter2
+	login: me@example.com
+	url: https://mail.google.com
+	otpauth://totp/gmail?secret=JBSWY3DPEHPK3PXP
+	anything else is kept as the note
+
+Files are decrypted and encrypted by running a command such as
+"gpg --quiet --batch --decrypt" that reads stdin and writes stdout, or read
+and written as is for a plaintext mirror of the tree.
+*/
+
+// passFields maps the keys pass extensions use to gopass fields.
+var passFields = map[string]string{
+	"login":    FieldUsername,
+	"username": FieldUsername,
+	"user":     FieldUsername,
+	"url":      FieldURL,
+	"website":  FieldURL,
+}
+
+// ParsePassEntry reads the plaintext of a pass file.
+func ParsePassEntry(name string, content []byte) Item {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	first, rest, _ := strings.Cut(text, "\n")
+	item := Item{Name: name, Value: first, Fields: make(map[string]string)}
+	var note []string
+	for _, line := range strings.Split(strings.TrimRight(rest, "\n"), "\n") {
+		if strings.HasPrefix(line, "otpauth://") {
+			item.Fields[FieldOTP] = strings.TrimSpace(line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if ok && key != "" && !strings.ContainsAny(key, " \t") && (value == "" || value[0] == ' ' || value[0] == '\t') {
+			key = strings.ToLower(key)
+			if field, known := passFields[key]; known {
+				key = field
+			}
+			if _, dup := item.Fields[key]; !dup {
+				item.Fields[key] = strings.TrimSpace(value)
+				continue
+			}
+		}
+		note = append(note, line)
+	}
+	if n := strings.TrimSpace(strings.Join(note, "\n")); n != "" {
+		item.Fields[FieldNote] = n
+	}
+	dropEmpty(item.Fields)
+	return item
+}
+
+// FormatPassEntry writes an entry the way ParsePassEntry reads it.
+func FormatPassEntry(item Item) []byte {
+	var b strings.Builder
+	b.WriteString(item.Value + "\n")
+	if u := item.Fields[FieldUsername]; u != "" {
+		b.WriteString("login: " + u + "\n")
+	}
+	if u := item.Fields[FieldURL]; u != "" {
+		b.WriteString("url: " + u + "\n")
+	}
+	for _, key := range slices.Sorted(maps.Keys(item.Fields)) {
+		switch key {
+		case FieldUsername, FieldURL, FieldNote:
+		case FieldOTP:
+			b.WriteString(item.Fields[key] + "\n")
+		default:
+			b.WriteString(key + ": " + item.Fields[key] + "\n")
+		}
+	}
+	if note := item.Fields[FieldNote]; note != "" {
+		b.WriteString(note + "\n")
+	}
+	return []byte(b.String())
+}
+
+// runFilter pipes input through command and returns its output.
+func runFilter(command []string, input []byte) ([]byte, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(input), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", command[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ReadPassDir reads every entry of a pass tree. With a decrypt command only
+// .gpg files are read and piped through it; without one the tree is a
+// plaintext mirror and every file is read as is. Hidden files and
+// directories such as .git and .gpg-id are ignored. Files that can't be
+// read or decrypted are returned in failed with the reason.
+func ReadPassDir(dir string, decrypt []string) (items []Item, failed []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if decrypt != nil && !strings.HasSuffix(name, ".gpg") {
+			return nil
+		}
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".gpg"), ".txt")
+
+		content, err := os.ReadFile(path)
+		if err == nil && decrypt != nil {
+			content, err = runFilter(decrypt, content)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			return nil
+		}
+		items = append(items, ParsePassEntry(name, content))
+		wipe(content)
+		return nil
+	})
+	return items, failed, err
+}
+
+// ImportPassDir imports a pass tree, see ReadPassDir, resolving name
+// collisions as opts says, and saves the vault once.
+func (v *Vault) ImportPassDir(dir string, decrypt []string, filepath string, opts ImportOptions) (*ImportReport, error) {
+	items, failed, err := ReadPassDir(dir, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	report, err := v.importItems(items, opts, filepath, "pass")
+	if err != nil {
+		return nil, err
+	}
+	report.Skipped = append(report.Skipped, failed...)
+	return report, nil
+}
+
+// ExportPassDir writes every entry to a pass tree under dir, encrypting each
+// file with the encrypt command into name.gpg, or as a plaintext name.txt
+// mirror if encrypt is nil. Directories are created readable only by the
+// owner, and so are plaintext files. Names that would end up outside dir
+// are returned in skipped.
+func (v *Vault) ExportPassDir(dir string, encrypt []string) (skipped []string, err error) {
+	items, err := v.items(false)
+	if err != nil {
+		return nil, err
+	}
+	ext := ".txt"
+	if encrypt != nil {
+		ext = ".gpg"
+	}
+	written := 0
+	for _, item := range items {
+		if !filepath.IsLocal(filepath.FromSlash(item.Name)) {
+			skipped = append(skipped, item.Name)
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(item.Name)) + ext
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		content := FormatPassEntry(item)
+		if encrypt != nil {
+			plain := content
+			content, err = runFilter(encrypt, plain)
+			wipe(plain)
+			if err != nil {
+				return nil, fmt.Errorf("encrypting %s: %w", item.Name, err)
+			}
+		}
+		err := WritePrivateFile(path, content)
+		wipe(content)
+		if err != nil {
+			return nil, err
+		}
+		written++
+	}
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries to %s as a pass tree", written, dir))
+	return skipped, nil
+}
@@ -0,0 +1,332 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+/*
+Recipient stanzas follow the age X25519 design: for every recipient an
+ephemeral key pair is generated, the shared secret is run through HKDF-SHA256
+(salted with both public keys) and the result seals the data key with
+ChaCha20-Poly1305. Only the holder of the matching identity can unwrap it.
+*/
+
+const (
+	publicKeyPrefix = "gopass1"
+	secretKeyPrefix = "GOPASS-SECRET-KEY-1"
+	stanzaInfo      = "gopass/v1/X25519"
+	identityEnv     = "GOPASS_IDENTITY"
+)
+
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type recipientStanza struct {
+	Recipient []byte // recipient public key, kept so the key can be rewrapped on rotation
+	Ephemeral []byte
+	Wrapped   []byte
+}
+
+// Identity is an X25519 private key able to open vaults it was added to.
+type Identity struct {
+	secret []byte
+	public []byte
+}
+
+// GenerateIdentity creates a new random X25519 identity.
+func GenerateIdentity() (*Identity, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %v", err)
+	}
+	return newIdentity(secret)
+}
+
+func newIdentity(secret []byte) (*Identity, error) {
+	public, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %v", err)
+	}
+	return &Identity{secret: secret, public: public}, nil
+}
+
+// ParseIdentity decodes an identity in its GOPASS-SECRET-KEY-1 string form.
+func ParseIdentity(s string) (*Identity, error) {
+	s = strings.TrimSpace(s)
+	rest, ok := strings.CutPrefix(s, secretKeyPrefix)
+	if !ok {
+		return nil, fmt.Errorf("identity must start with %s", secretKeyPrefix)
+	}
+	secret, err := keyEncoding.DecodeString(rest)
+	if err != nil || len(secret) != curve25519.ScalarSize {
+		return nil, errors.New("malformed identity")
+	}
+	return newIdentity(secret)
+}
+
+func (i *Identity) String() string {
+	return secretKeyPrefix + keyEncoding.EncodeToString(i.secret)
+}
+
+// Recipient returns the public key matching the identity.
+func (i *Identity) Recipient() string {
+	return formatRecipient(i.public)
+}
+
+func formatRecipient(pub []byte) string {
+	return publicKeyPrefix + strings.ToLower(keyEncoding.EncodeToString(pub))
+}
+
+// ParseRecipient decodes a gopass1... public key.
+func ParseRecipient(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	rest, ok := strings.CutPrefix(s, publicKeyPrefix)
+	if !ok {
+		return nil, fmt.Errorf("recipient must start with %s", publicKeyPrefix)
+	}
+	pub, err := keyEncoding.DecodeString(strings.ToUpper(rest))
+	if err != nil || len(pub) != curve25519.PointSize {
+		return nil, errors.New("malformed recipient public key")
+	}
+	return pub, nil
+}
+
+func stanzaKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key := newSecret(chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(stanzaInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func wrapForRecipient(recipient, dataKey []byte) (recipientStanza, error) {
+	eph := newSecret(curve25519.ScalarSize)
+	defer wipe(eph)
+	if _, err := rand.Read(eph); err != nil {
+		return recipientStanza{}, err
+	}
+	ephPub, err := curve25519.X25519(eph, curve25519.Basepoint)
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	shared, err := curve25519.X25519(eph, recipient)
+	if err != nil {
+		return recipientStanza{}, fmt.Errorf("invalid recipient: %v", err)
+	}
+	key, err := stanzaKey(shared, ephPub, recipient)
+	wipe(shared)
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	defer wipe(key)
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return recipientStanza{}, err
+	}
+	// each stanza key is used exactly once, so a zero nonce is safe
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return recipientStanza{
+		Recipient: recipient,
+		Ephemeral: ephPub,
+		Wrapped:   aead.Seal(nil, nonce, dataKey, nil),
+	}, nil
+}
+
+func (i *Identity) unwrap(s recipientStanza) ([]byte, error) {
+	if !bytes.Equal(s.Recipient, i.public) {
+		return nil, errors.New("stanza is for a different recipient")
+	}
+	shared, err := curve25519.X25519(i.secret, s.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	key, err := stanzaKey(shared, s.Ephemeral, i.public)
+	wipe(shared)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), s.Wrapped, nil)
+}
+
+// IdentityPath returns where the local identity is kept: $GOPASS_IDENTITY or ~/.gopass_identity.
+func IdentityPath() (string, error) {
+	if p := os.Getenv(identityEnv); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %v", err)
+	}
+	return filepath.Join(home, ".gopass_identity"), nil
+}
+
+// LoadIdentity reads the identity stored at path.
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return ParseIdentity(line)
+	}
+	return nil, fmt.Errorf("no identity found in %s", path)
+}
+
+// SaveIdentity writes the identity to path, refusing to overwrite an existing one.
+func SaveIdentity(path string, id *Identity) error {
+	content := fmt.Sprintf("# public key: %s\n%s\n", id.Recipient(), id.String())
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(content)
+	return err
+}
+
+func localIdentity() *Identity {
+	path, err := IdentityPath()
+	if err != nil {
+		return nil
+	}
+	id, err := LoadIdentity(path)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// Recipients lists the public keys the vault's data key is wrapped for.
+func (v *Vault) Recipients() []string {
+	if v.header == nil {
+		return nil
+	}
+	out := make([]string, 0, len(v.header.Recipients))
+	for _, s := range v.header.Recipients {
+		out = append(out, formatRecipient(s.Recipient))
+	}
+	return out
+}
+
+// AddRecipient wraps the current data key for another public key. Existing
+// recipients and the password keep working, nothing else is re-encrypted.
+func (v *Vault) AddRecipient(recipient, filepath string) error {
+	pub, err := ParseRecipient(recipient)
+	if err != nil {
+		return err
+	}
+	if err := v.ensureKey(filepath); err != nil {
+		return err
+	}
+	for _, s := range v.header.Recipients {
+		if bytes.Equal(s.Recipient, pub) {
+			return fmt.Errorf("recipient %s is already added", recipient)
+		}
+	}
+	stanza, err := wrapForRecipient(pub, v.dataKey)
+	if err != nil {
+		return err
+	}
+	v.header.Recipients = append(v.header.Recipients, stanza)
+	return v.Save(filepath)
+}
+
+// RemoveRecipient drops a public key and rotates the data key, so a copy of
+// the old stanza can't open anything written from now on.
+func (v *Vault) RemoveRecipient(recipient, filepath string) error {
+	pub, err := ParseRecipient(recipient)
+	if err != nil {
+		return err
+	}
+	if err := v.ensureKey(filepath); err != nil {
+		return err
+	}
+	var remaining [][]byte
+	found := false
+	for _, s := range v.header.Recipients {
+		if bytes.Equal(s.Recipient, pub) {
+			found = true
+			continue
+		}
+		remaining = append(remaining, s.Recipient)
+	}
+	if !found {
+		return fmt.Errorf("recipient %s is not in this vault", recipient)
+	}
+	if len(remaining) == 0 && v.header.Salt == nil {
+		return errors.New("cannot remove the last recipient of a vault without a password")
+	}
+	return v.rotateKey(filepath, remaining)
+}
+
+// rotateKey replaces the data key and rewraps it for the password and the
+// given recipients. Every record is sealed again under the new key. The
+// password comes from the keyring or the prompt and is checked against the
+// current stanza first.
+func (v *Vault) rotateKey(filepath string, recipients [][]byte) error {
+	dataKey, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	h := &header{ID: v.header.ID, KDF: v.header.KDF, Iterations: v.header.Iterations}
+	if v.header.Salt != nil {
+		// only a password that opens the current stanza may wrap the new
+		// key, a stale keyring password would lock the password out
+		h.Salt = v.header.Salt
+		err := withPassword(filepath, v.env(), func(password []byte) error {
+			current, err := unwrapWithPassword(password, v.header)
+			if err != nil {
+				return err
+			}
+			same := bytes.Equal(current, v.dataKey)
+			wipe(current)
+			if !same {
+				return fmt.Errorf("%w: the password stanza doesn't hold the vault's key", ErrIntegrity)
+			}
+			h.Password, err = wrapWithPassword(password, h, dataKey)
+			return err
+		})
+		if err != nil {
+			releaseKey(dataKey)
+			return err
+		}
+	}
+	for _, r := range recipients {
+		stanza, err := wrapForRecipient(r, dataKey)
+		if err != nil {
+			releaseKey(dataKey)
+			return err
+		}
+		h.Recipients = append(h.Recipients, stanza)
+	}
+	if err := v.rekey(dataKey); err != nil {
+		releaseKey(dataKey)
+		return err
+	}
+	releaseKey(v.dataKey)
+	v.header = h
+	v.dataKey = dataKey
+	return v.Save(filepath)
+}
@@ -0,0 +1,463 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+/*
+Since format v4 every secret value is sealed on its own. The body of the file is
+
+	gob(sealedBody{Index: seal(indexKey, gob(index), header), Records: id -> seal(recordKey, gob(record), vaultID | id)})
+
+The index holds entry names and non-secret metadata and is the only thing
+decrypted on Load. Records are opened one at a time by Value, so listing or
+searching names never puts other secrets in memory. Record IDs are random,
+and the index pins each record's digest, so records can't be swapped between
+entries or rolled back individually.
+*/
+
+const recordIDSize = 16
+
+// indexEntry is the non-secret part of an entry.
+type indexEntry struct {
+	Record      string // hex id of the sealed record holding the value
+	Digest      []byte // SHA-256 of the sealed record
+	Attachments map[string]sealedRef
+
+	Created    time.Time
+	Changed    time.Time // last time the value itself was set
+	Expires    time.Time // zero if the entry doesn't expire
+	RotateDays int       // rotation policy in days, 0 if none
+}
+
+// sealedRef points at a sealed record holding raw bytes, e.g. an attachment.
+type sealedRef struct {
+	Record string
+	Digest []byte
+	Size   int64
+}
+
+type index struct {
+	Entries map[string]indexEntry
+	Trash   map[string][]trashedEntry
+	Log     *logState
+}
+
+// record is the plaintext of one sealed secret.
+type record struct {
+	Value  string
+	Fields map[string]string // extra secret fields, e.g. an otpauth URI
+}
+
+type sealedBody struct {
+	Index   []byte
+	Records map[string][]byte
+}
+
+// subkey derives a purpose-specific key from the data key, the caller must wipe it.
+func (v *Vault) subkey(info string) ([]byte, error) {
+	key := newSecret(dataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, v.dataKey, v.header.ID, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (v *Vault) recordAD(id string) []byte {
+	return append(append([]byte{}, v.header.ID...), id...)
+}
+
+// pendingRecord returns the unsaved record of name, starting from its sealed
+// record (or a blank one) when it has no unsaved changes yet.
+func (v *Vault) pendingRecord(name string) (*record, error) {
+	if r, ok := v.pending[name]; ok {
+		return r, nil
+	}
+	r := &record{}
+	if _, sealed := v.index[name]; sealed {
+		var err error
+		if r, err = v.openRecord(name); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := v.Entries[name]; ok {
+		r.Value = value
+	}
+	if v.pending == nil {
+		v.pending = make(map[string]*record)
+	}
+	v.pending[name] = r
+	return r, nil
+}
+
+// newRecordID returns a random hex record id.
+func newRecordID() (string, error) {
+	rawID := make([]byte, recordIDSize)
+	if _, err := rand.Read(rawID); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(rawID), nil
+}
+
+// sealPending moves every value from Entries, every unsaved record and every
+// new attachment into its own sealed record. Records of untouched entries are
+// kept as they are.
+func (v *Vault) sealPending() error {
+	if len(v.Entries) == 0 && len(v.pending) == 0 && len(v.pendingFiles) == 0 {
+		return nil
+	}
+	changedAt := v.env().Now()
+	valueChanged := make(map[string]bool, len(v.Entries))
+	for name := range v.Entries {
+		if _, err := v.pendingRecord(name); err != nil {
+			return err
+		}
+		v.pending[name].Value = v.Entries[name]
+		valueChanged[name] = true
+	}
+
+	key, err := v.subkey("gopass record")
+	if err != nil {
+		return err
+	}
+	defer wipe(key)
+	if v.index == nil {
+		v.index = make(map[string]indexEntry)
+	}
+	if v.records == nil {
+		v.records = make(map[string][]byte)
+	}
+
+	for name, r := range v.pending {
+		id, err := newRecordID()
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+			return fmt.Errorf("failed to encode entry '%s': %v", name, err)
+		}
+		sealed, err := seal(key, buf.Bytes(), v.recordAD(id))
+		wipe(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		e := v.index[name]
+		delete(v.records, e.Record)
+		digest := sha256.Sum256(sealed)
+		v.records[id] = sealed
+		e.Record, e.Digest = id, digest[:]
+		if e.Created.IsZero() {
+			e.Created = changedAt
+		}
+		if valueChanged[name] || e.Changed.IsZero() {
+			e.Changed = changedAt
+		}
+		v.index[name] = e
+		delete(v.Entries, name)
+		delete(v.pending, name)
+	}
+
+	for name, files := range v.pendingFiles {
+		e, ok := v.index[name]
+		if !ok {
+			continue
+		}
+		if e.Attachments == nil {
+			e.Attachments = make(map[string]sealedRef)
+		}
+		for file, content := range files {
+			id, err := newRecordID()
+			if err != nil {
+				return err
+			}
+			sealed, err := seal(key, content, v.recordAD(id))
+			if err != nil {
+				return err
+			}
+			delete(v.records, e.Attachments[file].Record)
+			digest := sha256.Sum256(sealed)
+			v.records[id] = sealed
+			e.Attachments[file] = sealedRef{Record: id, Digest: digest[:], Size: int64(len(content))}
+			wipe(content)
+		}
+		v.index[name] = e
+		delete(v.pendingFiles, name)
+	}
+	return nil
+}
+
+// openSealed checks a record against its digest and decrypts it.
+func (v *Vault) openSealed(id string, digest []byte) ([]byte, error) {
+	sealed, ok := v.records[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: record is missing", ErrIntegrity)
+	}
+	if d := sha256.Sum256(sealed); !bytes.Equal(d[:], digest) {
+		return nil, fmt.Errorf("%w: record was replaced", ErrIntegrity)
+	}
+	key, err := v.subkey("gopass record")
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(key, sealed, v.recordAD(id))
+	wipe(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: record failed to decrypt", ErrIntegrity)
+	}
+	return plaintext, nil
+}
+
+// openRecord decrypts the record of a single entry.
+func (v *Vault) openRecord(name string) (*record, error) {
+	e, ok := v.index[name]
+	if !ok {
+		return nil, fmt.Errorf("'%s' doesnt exist in vault", name)
+	}
+	plaintext, err := v.openSealed(e.Record, e.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("entry '%s': %w", name, err)
+	}
+	defer wipe(plaintext)
+	var r record
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode entry '%s': %v", name, err)
+	}
+	return &r, nil
+}
+
+// Value decrypts and returns the value of a single entry.
+func (v *Vault) Value(name string) (string, error) {
+	if value, ok := v.Entries[name]; ok {
+		return value, nil
+	}
+	r, err := v.record(name)
+	if err != nil {
+		return "", err
+	}
+	return r.Value, nil
+}
+
+// record returns the unsaved record of name, or decrypts its sealed one.
+func (v *Vault) record(name string) (*record, error) {
+	if r, ok := v.pending[name]; ok {
+		return r, nil
+	}
+	return v.openRecord(name)
+}
+
+// Field decrypts a single field of an entry.
+func (v *Vault) Field(name, field string) (string, error) {
+	r, err := v.record(name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := r.Fields[field]
+	if !ok {
+		return "", fmt.Errorf("entry '%s' has no field '%s'", name, field)
+	}
+	return value, nil
+}
+
+// FieldNames returns the sorted field names of an entry.
+func (v *Vault) FieldNames(name string) ([]string, error) {
+	r, err := v.record(name)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(r.Fields)), nil
+}
+
+// SetField stores a secret field on an existing entry and saves the vault.
+// An empty value removes the field.
+func (v *Vault) SetField(name, field, value, filepath string) error {
+	if name == "" || field == "" {
+		return fmt.Errorf("entry and field name cannot be empty")
+	}
+	if !v.Has(name) {
+		return fmt.Errorf("entry with name '%s' doesn't exists", name)
+	}
+	r, err := v.pendingRecord(name)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		delete(r.Fields, field)
+	} else {
+		if r.Fields == nil {
+			r.Fields = make(map[string]string)
+		}
+		r.Fields[field] = value
+	}
+	return v.Save(filepath)
+}
+
+// Has reports whether an entry exists, without decrypting anything.
+func (v *Vault) Has(name string) bool {
+	if _, ok := v.Entries[name]; ok {
+		return true
+	}
+	if _, ok := v.pending[name]; ok {
+		return true
+	}
+	_, ok := v.index[name]
+	return ok
+}
+
+// Names returns the sorted names of all entries, without decrypting any value.
+func (v *Vault) Names() []string {
+	names := make(map[string]bool, len(v.index)+len(v.Entries))
+	for n := range v.index {
+		names[n] = true
+	}
+	for n := range v.Entries {
+		names[n] = true
+	}
+	for n := range v.pending {
+		names[n] = true
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+// delete removes an entry and its records for good.
+func (v *Vault) delete(name string) {
+	delete(v.Entries, name)
+	delete(v.pending, name)
+	delete(v.pendingFiles, name)
+	if e, ok := v.index[name]; ok {
+		v.dropRecords(e)
+		delete(v.index, name)
+	}
+}
+
+// dropRecords deletes the sealed records an index entry points at.
+func (v *Vault) dropRecords(e indexEntry) {
+	delete(v.records, e.Record)
+	for _, a := range e.Attachments {
+		delete(v.records, a.Record)
+	}
+}
+
+// rekey seals every record again under the record key derived from newKey,
+// keeping record ids, and updates the digests pinned by the index and trash.
+func (v *Vault) rekey(newKey []byte) error {
+	if err := v.sealPending(); err != nil {
+		return err
+	}
+	oldKey, err := v.subkey("gopass record")
+	if err != nil {
+		return err
+	}
+	defer wipe(oldKey)
+	next := &Vault{header: v.header, dataKey: newKey}
+	newRecordKey, err := next.subkey("gopass record")
+	if err != nil {
+		return err
+	}
+	defer wipe(newRecordKey)
+
+	resealed := make(map[string][]byte, len(v.records))
+	digests := make(map[string][]byte, len(v.records))
+	for id, sealed := range v.records {
+		plaintext, err := open(oldKey, sealed, v.recordAD(id))
+		if err != nil {
+			return fmt.Errorf("%w: record failed to decrypt", ErrIntegrity)
+		}
+		resealed[id], err = seal(newRecordKey, plaintext, v.recordAD(id))
+		wipe(plaintext)
+		if err != nil {
+			return err
+		}
+		d := sha256.Sum256(resealed[id])
+		digests[id] = d[:]
+	}
+
+	update := func(e *indexEntry) {
+		e.Digest = digests[e.Record]
+		for file, a := range e.Attachments {
+			a.Digest = digests[a.Record]
+			e.Attachments[file] = a
+		}
+	}
+	for name, e := range v.index {
+		update(&e)
+		v.index[name] = e
+	}
+	for _, items := range v.trash {
+		for i := range items {
+			update(&items[i].Entry)
+		}
+	}
+	v.records = resealed
+	return nil
+}
+
+func (v *Vault) marshalBody(ad []byte) ([]byte, error) {
+	key, err := v.subkey("gopass index")
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	var ibuf bytes.Buffer
+	if err := gob.NewEncoder(&ibuf).Encode(index{Entries: v.index, Trash: v.trash, Log: v.log}); err != nil {
+		return nil, fmt.Errorf("failed to encode vault index: %v", err)
+	}
+	sealedIndex, err := seal(key, ibuf.Bytes(), ad)
+	wipe(ibuf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := gob.NewEncoder(&out).Encode(sealedBody{Index: sealedIndex, Records: v.records}); err != nil {
+		return nil, fmt.Errorf("failed to encode vault: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+func (v *Vault) unmarshalBody(body, ad []byte) error {
+	var sb sealedBody
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&sb); err != nil {
+		return fmt.Errorf("%w: failed to decode vault body: %v", ErrIntegrity, err)
+	}
+	key, err := v.subkey("gopass index")
+	if err != nil {
+		return err
+	}
+	plaintext, err := open(key, sb.Index, ad)
+	wipe(key)
+	if err != nil {
+		return ErrIntegrity
+	}
+	defer wipe(plaintext)
+	var idx index
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&idx); err != nil {
+		return fmt.Errorf("failed to decode vault index: %v", err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]indexEntry)
+	}
+	if sb.Records == nil {
+		sb.Records = make(map[string][]byte)
+	}
+	v.index = idx.Entries
+	v.trash = idx.Trash
+	v.log = idx.Log
+	if v.log != nil {
+		lockKey(v.log.Key)
+	}
+	v.records = sb.Records
+	return nil
+}
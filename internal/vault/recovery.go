@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/prozod/gopass/internal/shamir"
+)
+
+/*
+Recovery shares are Shamir shares of the vault's data key. Each one is printed as
+
+	GOPASS-SHARE-<base32(version | splitID(4) | threshold | x | y | checksum(4))>
+
+The alphabet is upper-case alphanumerics and '-', which QR codes encode in
+their compact alphanumeric mode. The checksum is the first 4 bytes of the
+SHA-256 of everything before it, so a mistyped share is rejected on its own.
+*/
+
+const (
+	sharePrefix   = "GOPASS-SHARE-"
+	shareVersion  = 1
+	splitIDSize   = 4
+	checksumSize  = 4
+	shareMetaSize = 1 + splitIDSize + 1 + 1
+)
+
+// RecoveryShare is a decoded recovery share.
+type RecoveryShare struct {
+	SplitID   [splitIDSize]byte
+	Threshold int
+	share     shamir.Share
+}
+
+func encodeShare(id [splitIDSize]byte, threshold int, s shamir.Share) string {
+	raw := []byte{shareVersion}
+	raw = append(raw, id[:]...)
+	raw = append(raw, byte(threshold), s.X)
+	raw = append(raw, s.Y...)
+	sum := sha256.Sum256(raw)
+	raw = append(raw, sum[:checksumSize]...)
+	return sharePrefix + keyEncoding.EncodeToString(raw)
+}
+
+// ParseShare decodes a share, ignoring whitespace and case, and verifies its checksum.
+func ParseShare(s string) (RecoveryShare, error) {
+	s = strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	rest, ok := strings.CutPrefix(s, sharePrefix)
+	if !ok {
+		return RecoveryShare{}, fmt.Errorf("share must start with %s", sharePrefix)
+	}
+	raw, err := keyEncoding.DecodeString(rest)
+	if err != nil || len(raw) < shareMetaSize+checksumSize+1 {
+		return RecoveryShare{}, errors.New("share is malformed")
+	}
+	body, sum := raw[:len(raw)-checksumSize], raw[len(raw)-checksumSize:]
+	want := sha256.Sum256(body)
+	if !bytes.Equal(sum, want[:checksumSize]) {
+		return RecoveryShare{}, errors.New("share checksum mismatch, it was probably mistyped")
+	}
+	if body[0] != shareVersion {
+		return RecoveryShare{}, fmt.Errorf("unsupported share version %d", body[0])
+	}
+	var rs RecoveryShare
+	copy(rs.SplitID[:], body[1:1+splitIDSize])
+	rs.Threshold = int(body[1+splitIDSize])
+	rs.share = shamir.Share{X: body[2+splitIDSize], Y: append([]byte{}, body[shareMetaSize:]...)}
+	return rs, nil
+}
+
+// Index is the share's position (1..n) within its split.
+func (r RecoveryShare) Index() int {
+	return int(r.share.X)
+}
+
+// SplitKey splits the vault's data key into n recovery shares, any threshold
+// of which can restore access. The vault is saved so the file on disk is
+// sealed with the key being split; inside a batch that happens at Commit.
+// Rotating the data key (for example by removing a recipient) invalidates
+// earlier shares.
+func (v *Vault) SplitKey(filepath string, n, threshold int) ([]string, error) {
+	if err := v.Save(filepath); err != nil {
+		return nil, err
+	}
+	parts, err := shamir.Split(v.dataKey, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+	var id [splitIDSize]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	out := make([]string, len(parts))
+	for i, p := range parts {
+		out[i] = encodeShare(id, threshold, p)
+	}
+	v.logEvent(filepath, "split", "", fmt.Sprintf("%d recovery shares, %d needed", n, threshold))
+	return out, nil
+}
+
+// CombineShares rebuilds the data key of the vault at filepath from recovery
+// shares, then replaces its password with newPassword. Recipients are kept.
+func CombineShares(filepath string, shares []RecoveryShare, newPassword string) (*Vault, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	if newPassword == "" {
+		return nil, errors.New("new password cannot be empty")
+	}
+	first := shares[0]
+	for _, s := range shares[1:] {
+		if s.SplitID != first.SplitID {
+			return nil, errors.New("shares come from different splits")
+		}
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("need %d shares, got %d", first.Threshold, len(shares))
+	}
+
+	parts := make([]shamir.Share, len(shares))
+	for i, s := range shares {
+		parts[i] = s.share
+	}
+	dataKey, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, err
+	}
+	lockKey(dataKey)
+
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault file: %v", err)
+	}
+	f, err := parseFile(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err := openFile(f, dataKey)
+	if err != nil {
+		releaseKey(dataKey)
+		return nil, errors.New("shares do not open this vault (wrong vault or the key was rotated since the split)")
+	}
+	h := v.header
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("salt error: %v", err)
+	}
+	h.Salt = salt
+	passBytes := []byte(newPassword)
+	h.Password, err = wrapWithPassword(passBytes, h, dataKey)
+	wipe(passBytes)
+	if err != nil {
+		return nil, err
+	}
+	vaultOpened()
+
+	if err := v.Save(filepath); err != nil {
+		return nil, err
+	}
+	if err := keyring.Set(service, "vault:"+filepath, newPassword); err != nil {
+		fmt.Fprintf(v.env().Out, "Warning: failed to store password in keyring: %v\n", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestParseShareChecksum(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "split.dat")
+	_ = keyring.Set(service, "vault:"+path, "pw")
+	v := &Vault{Entries: map[string]string{"a": "b"}}
+	shares, err := v.SplitKey(path, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := keyEncoding.DecodeString(strings.TrimPrefix(shares[0], sharePrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		at   int
+	}{
+		{"version", 0},
+		{"split id", 1},
+		{"threshold", 1 + splitIDSize},
+		{"x", 2 + splitIDSize},
+		{"y", shareMetaSize + 5},
+		{"checksum", len(raw) - 1},
+	} {
+		bad := append([]byte{}, raw...)
+		bad[tt.at] ^= 0x01
+		_, err := ParseShare(sharePrefix + keyEncoding.EncodeToString(bad))
+		if err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("changed %s: expected a checksum error, got %v", tt.name, err)
+		}
+	}
+	if _, err := ParseShare(strings.ToLower(shares[0])); err != nil {
+		t.Fatalf("intact share rejected: %v", err)
+	}
+}
+
+func TestSplitKeyInBatch(t *testing.T) {
+	keyring.MockInit()
+	path := filepath.Join(t.TempDir(), "batch.dat")
+	_ = keyring.Set(service, "vault:"+path, "pw")
+	v := &Vault{Entries: map[string]string{"root": "toor"}}
+	v.Begin()
+	shares, err := v.SplitKey(path, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("split wrote the vault before the batch was committed")
+	}
+	if err := v.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed []RecoveryShare
+	for _, s := range shares[1:] {
+		p, err := ParseShare(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, p)
+	}
+	recovered, err := CombineShares(path, parsed, "new")
+	if err != nil {
+		t.Fatalf("shares don't open the committed vault: %v", err)
+	}
+	defer recovered.Close()
+	if value, _ := recovered.Value("root"); value != "toor" {
+		t.Fatal("entry lost after recovery")
+	}
+}
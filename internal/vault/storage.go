@@ -3,24 +3,18 @@ package vault
 import (
 	"bufio"
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strings"
 
 	"golang.org/x/crypto/pbkdf2"
 
 	"github.com/zalando/go-keyring"
-	"golang.org/x/term"
-
-	"github.com/prozod/gopass/internal/common"
 )
 
 var lastCachedVault string
@@ -34,28 +28,44 @@ const (
 )
 
 func deriveKey(password, salt []byte) ([]byte, error) {
-	key := pbkdf2.Key(password, salt, pbkdf2Iterations, keyLen, sha256.New)
+	return deriveKeyWith(password, salt, pbkdf2Iterations)
+}
+
+// deriveKeyWith returns a PBKDF2 key in a fresh secret buffer, the caller must wipe it.
+func deriveKeyWith(password, salt []byte, iterations int) ([]byte, error) {
+	derived := pbkdf2.Key(password, salt, iterations, keyLen, sha256.New)
+	key := newSecret(len(derived))
+	copy(key, derived)
+	wipe(derived)
 	return key, nil
 }
 
+// maxPasswordAttempts is how many prompted passwords LoadWithIO tries
+// before giving up with ErrWrongPassword.
+const maxPasswordAttempts = 3
+
+// LoadWithReader opens the vault at filepath like Load, asking reader for
+// passwords the keyring doesn't have.
 func LoadWithReader(filepath string, reader PasswordReader) (*Vault, error) {
-	data, err := os.ReadFile(filepath)
-	keyID := "vault:" + filepath
-	var password string
+	return LoadWithIO(filepath, IO{Prompt: reader})
+}
 
+// LoadWithIO opens the vault at filepath, or creates it if it doesn't exist.
+// The password comes from the keyring, else from x.Prompt, and the one that
+// works is kept in the keyring. The vault uses x from then on.
+func LoadWithIO(filepath string, x IO) (*Vault, error) {
+	env := x.withDefaults()
+	data, err := os.ReadFile(filepath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Println(common.Blue + "Vault file not found. Creating new vault." + common.Reset)
-			passBytes, err := reader.Read(common.Green + "Enter password for new vault: " + common.Reset)
-			fmt.Println()
+			password, err := env.Prompt.Read("Enter password for new vault: ")
 			if err != nil {
 				return nil, fmt.Errorf("failed to read password: %v", err)
 			}
-			password = string(passBytes)
-			if err := keyring.Set(service, keyID, password); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to store password in keyring: %v\n", err)
+			if err := keyring.Set(service, "vault:"+filepath, password); err != nil {
+				fmt.Fprintf(env.Out, "Warning: failed to store password in keyring: %v\n", err)
 			}
-			vault := &Vault{Entries: make(map[string]string)}
+			vault := &Vault{Entries: make(map[string]string), io: x}
 			if err := vault.Save(filepath); err != nil {
 				return nil, fmt.Errorf("failed to save initial vault: %v", err)
 			}
@@ -64,150 +74,400 @@ func LoadWithReader(filepath string, reader PasswordReader) (*Vault, error) {
 		return nil, fmt.Errorf("failed to read vault file: %v", err)
 	}
 
-tryDecrypt:
-	password, err = keyring.Get(service, keyID)
+	if hasMagic(data) {
+		return loadVersioned(filepath, data, x)
+	}
+
+	salt, nonce, ciphertext, err := splitLegacy(data)
 	if err != nil {
-		fmt.Print("Enter password to decrypt vault: ")
-		passBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-		fmt.Println()
+		return nil, err
+	}
+
+	var key, plaintext []byte
+	err = withPassword(filepath, env, func(password []byte) error {
+		k, err := deriveKey(password, salt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read password: %v", err)
+			return fmt.Errorf("key derivation failed: %v", err)
 		}
-		password = string(passBytes)
-		_ = keyring.Set(service, keyID, password)
+		gcm, err := newGCM(k)
+		if err != nil {
+			wipe(k)
+			return err
+		}
+		if plaintext, err = gcm.Open(nil, nonce, ciphertext, nil); err != nil {
+			wipe(k)
+			return ErrWrongPassword
+		}
+		key = k
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	var v Vault
+	v.Entries, err = decodeLegacy(plaintext)
+	wipe(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	// legacy vaults are upgraded on the next Save: the password-derived key
+	// becomes the key-encryption key for a fresh random data key
+	if v.dataKey, err = newDataKey(); err != nil {
+		return nil, err
 	}
+	if v.header, err = newHeader(); err != nil {
+		return nil, err
+	}
+	v.header.Salt = append([]byte{}, salt...)
+	v.header.KeyCheck = keyCheck(key)
+	if v.header.Password, err = seal(key, v.dataKey, nil); err != nil {
+		return nil, err
+	}
+
+	v.path = filepath
+	v.io = x
+	vaultOpened()
+	return &v, nil
+}
 
+// splitLegacy splits a legacy vault file into its salt, nonce and ciphertext.
+func splitLegacy(data []byte) (salt, nonce, ciphertext []byte, err error) {
 	if len(data) < saltSize+nonceSize {
-		return nil, fmt.Errorf("vault file is too short or corrupted")
+		return nil, nil, nil, fmt.Errorf("vault file is too short or corrupted")
 	}
-	salt := data[:saltSize]
-	nonce := data[saltSize : saltSize+nonceSize]
-	ciphertext := data[saltSize+nonceSize:]
+	return data[:saltSize], data[saltSize : saltSize+nonceSize], data[saltSize+nonceSize:], nil
+}
 
-	key, err := deriveKey([]byte(password), salt)
-	if err != nil {
-		return nil, fmt.Errorf("key derivation failed: %v", err)
+// decodeLegacy decodes the decrypted entries of a legacy vault file.
+func decodeLegacy(plaintext []byte) (map[string]string, error) {
+	entries := make(map[string]string)
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode vault data: %v", err)
+	}
+	if entries == nil {
+		entries = make(map[string]string)
 	}
+	return entries, nil
+}
 
-	block, err := aes.NewCipher(key)
+// withPassword calls try with the keyring password of the vault at filepath,
+// then with passwords from env.Prompt while try fails with ErrWrongPassword,
+// up to maxPasswordAttempts of them. The password that works is kept in the
+// keyring.
+func withPassword(filepath string, env IO, try func(password []byte) error) error {
+	keyID := "vault:" + filepath
+	password, err := keyring.Get(service, keyID)
+	prompt := err != nil
+	for attempts := 0; ; {
+		if prompt {
+			if attempts == maxPasswordAttempts {
+				return ErrWrongPassword
+			}
+			attempts++
+			if password, err = env.Prompt.Read("Enter password to decrypt vault: "); err != nil {
+				return fmt.Errorf("failed to read password: %v", err)
+			}
+		}
+		passBytes := []byte(password)
+		err := try(passBytes)
+		wipe(passBytes)
+		if err == nil {
+			_ = keyring.Set(service, keyID, password)
+			return nil
+		}
+		if !errors.Is(err, ErrWrongPassword) {
+			return err
+		}
+		fmt.Fprintln(env.Out, "Decryption failed. Possibly wrong password.")
+		_ = keyring.Delete(service, keyID)
+		prompt = true
+	}
+}
+
+func loadVersioned(filepath string, data []byte, x IO) (*Vault, error) {
+	f, err := parseFile(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher block: %v", err)
+		return nil, err
+	}
+	h := f.header
+
+	dataKey := identityKey(h)
+	if dataKey == nil {
+		if h.Salt == nil {
+			return nil, fmt.Errorf("vault is shared with recipients only and no matching identity was found (see 'gopass keygen')")
+		}
+		err := withPassword(filepath, x.withDefaults(), func(password []byte) error {
+			var err error
+			dataKey, err = unwrapWithPassword(password, h)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	v, err := openWithKey(filepath, f, dataKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM cipher: %v", err)
+		return nil, err
 	}
+	v.io = x
+	return v, nil
+}
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+// identityKey unwraps the data key with the local identity, or returns nil
+// if there is none or it isn't a recipient.
+func identityKey(h *header) []byte {
+	id := localIdentity()
+	if id == nil {
+		return nil
+	}
+	for _, s := range h.Recipients {
+		if k, err := id.unwrap(s); err == nil {
+			return k
+		}
+	}
+	return nil
+}
+
+func openWithKey(filepath string, f *parsedFile, dataKey []byte) (*Vault, error) {
+	v, err := openFile(f, dataKey)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Decryption failed. Possibly wrong password.")
-		_ = keyring.Delete(service, keyID)
+		wipe(dataKey)
+		return nil, fmt.Errorf("failed to decrypt vault data: %w", err)
+	}
+	lockKey(v.dataKey)
+	v.path = filepath
+	vaultOpened()
+	return v, nil
+}
 
-		fmt.Print("Enter password to decrypt vault: ")
-		passBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-		fmt.Println()
+// OpenFile opens the vault at filepath with the local identity if it is a
+// recipient, else with the password from reader. Unlike Load it never uses
+// the keyring, prompts or prints; a wrong password is ErrWrongPassword.
+func OpenFile(filepath string, reader PasswordReader) (*Vault, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	if !hasMagic(data) {
+		return nil, errors.New("vault uses the old file format, change it once with the gopass CLI to upgrade it")
+	}
+	f, err := parseFile(data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := identityKey(f.header)
+	if dataKey == nil {
+		if f.header.Salt == nil {
+			return nil, errors.New("vault is shared with recipients only and no matching identity was found")
+		}
+		password, err := reader.Read("Vault password: ")
 		if err != nil {
 			return nil, fmt.Errorf("failed to read password: %v", err)
 		}
-		password = string(passBytes)
-		_ = keyring.Set(service, keyID, password)
-		goto tryDecrypt
+		passBytes := []byte(password)
+		dataKey, err = unwrapWithPassword(passBytes, f.header)
+		wipe(passBytes)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return openWithKey(filepath, f, dataKey)
+}
 
-	var v Vault
-	v.Entries = make(map[string]string)
-	decoder := gob.NewDecoder(bytes.NewReader(plaintext))
-	if err := decoder.Decode(&v.Entries); err != nil {
-		return nil, fmt.Errorf("failed to decode vault data: %v", err)
+// CreateFile writes a new empty vault protected by password to filepath,
+// which must not exist yet, without using the keyring.
+func CreateFile(filepath, password string) (*Vault, error) {
+	if password == "" {
+		return nil, errors.New("the vault password cannot be empty")
 	}
-
-	return &v, nil
+	if _, err := os.Stat(filepath); err == nil {
+		return nil, fmt.Errorf("%s already exists", filepath)
+	}
+	v := &Vault{Entries: make(map[string]string)}
+	if err := v.initKey(password); err != nil {
+		return nil, err
+	}
+	if err := v.Save(filepath); err != nil {
+		v.Close()
+		return nil, err
+	}
+	return v, nil
 }
 
+// Load opens the vault at filepath, see LoadWithIO, prompting on the
+// terminal.
 func Load(filepath string) (*Vault, error) {
-	return LoadWithReader(filepath, TerminalPasswordReader{})
+	return LoadWithIO(filepath, IO{})
 }
 
+// Save seals every pending change and writes the vault to filepath. Inside
+// a batch it only marks the vault for writing by Commit.
 func (v *Vault) Save(filepath string) error {
-	// pw from keyring
-	keyID := "vault:" + filepath
-	password, err := keyring.Get(service, keyID)
-	if err != nil {
-		return fmt.Errorf("no password found in keyring for %s: %v", filepath, err)
+	if err := v.ensureKey(filepath); err != nil {
+		return err
 	}
-
-	var salt []byte
-
-	// if file exists, extract the salt for reuse
-	if existingData, err := os.ReadFile(filepath); err == nil && len(existingData) >= saltSize {
-		salt = existingData[:saltSize]
-	} else {
-		salt = make([]byte, saltSize)
-		if _, err := rand.Read(salt); err != nil {
-			return fmt.Errorf("salt error: %v", err)
+	if v.batch > 0 {
+		if err := v.markBatch(filepath); err != nil {
+			return err
 		}
+		v.batchBackup = true
+		return nil
 	}
+	return v.write(filepath, true)
+}
 
-	// encode entries to plaintext
-	var buf bytes.Buffer
-	encoder := gob.NewEncoder(&buf)
-	err = encoder.Encode(v.Entries)
-	if err != nil {
-		return fmt.Errorf("failed to encode vault: %v", err)
+// saveLogHead saves the vault after an audit log record was appended. Only
+// the log head in the index changed, so no backup is rotated for it.
+func (v *Vault) saveLogHead(filepath string) error {
+	if v.batch > 0 {
+		return v.markBatch(filepath)
 	}
-	plaintext := buf.Bytes()
+	return v.write(filepath, false)
+}
 
-	key, err := deriveKey([]byte(password), salt)
-	if err != nil {
-		return err
+// markBatch makes the Commit of the current batch write to filepath.
+func (v *Vault) markBatch(filepath string) error {
+	if v.batchPath != "" && v.batchPath != filepath {
+		return fmt.Errorf("the batch already writes to %s", v.batchPath)
 	}
+	v.batchPath = filepath
+	v.path = filepath
+	return nil
+}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return err
+// Begin starts a batch: until the matching Commit, Save doesn't encrypt or
+// write anything, so a command changing many entries writes the file (and
+// rotates the backups) once. Batches nest and only the outermost Commit
+// writes. Changes made in a batch that is never committed stay in memory.
+func (v *Vault) Begin() {
+	v.batch++
+}
+
+// Commit ends a batch and writes the vault if anything in it was saved.
+func (v *Vault) Commit() error {
+	if v.batch == 0 {
+		return errors.New("commit without a batch")
+	}
+	v.batch--
+	if v.batch > 0 || v.batchPath == "" {
+		return nil
 	}
+	filepath, backup := v.batchPath, v.batchBackup
+	v.batchPath, v.batchBackup, v.batchLog = "", false, nil
+	return v.write(filepath, backup)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// Discard ends a batch like Commit but writes nothing: the outermost Discard
+// drops the pending write and cuts the audit records appended in the batch
+// from the log again. Changes saved in the batch stay in memory only.
+func (v *Vault) Discard() error {
+	if v.batch == 0 {
+		return errors.New("discard without a batch")
+	}
+	v.batch--
+	if v.batch > 0 {
+		return nil
+	}
+	mark := v.batchLog
+	v.batchPath, v.batchBackup, v.batchLog = "", false, nil
+	if mark == nil {
+		return nil
+	}
+	return v.rewindLog(mark)
+}
+
+// write seals the pending changes and replaces the file at filepath,
+// keeping the old file as a backup if backup is set.
+func (v *Vault) write(filepath string, backup bool) error {
+	data, err := v.marshal()
 	if err != nil {
 		return err
 	}
 
-	nonce := make([]byte, nonceSize)
-	if _, err := rand.Read(nonce); err != nil {
+	keep := 0
+	if backup {
+		keep = backupCount()
+	}
+	if err := writeFile(filepath, data, keep, v.env().Out); err != nil {
 		return err
 	}
+	v.path = filepath
+	return nil
+}
 
-	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
-
-	f, err := os.Create(filepath)
+// ensureKey gives a vault that was never loaded from disk a data key,
+// wrapped with the password stored in the keyring.
+func (v *Vault) ensureKey(filepath string) error {
+	if v.dataKey != nil {
+		return nil
+	}
+	password, err := KeyringPassword(filepath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	return v.initKey(password)
+}
 
-	if _, err := f.Write(salt); err != nil {
+// initKey gives the vault a fresh data key wrapped with password.
+func (v *Vault) initKey(password string) error {
+	h, err := newHeader()
+	if err != nil {
 		return err
 	}
-	if _, err := f.Write(nonce); err != nil {
+	h.Salt = make([]byte, saltSize)
+	if _, err := rand.Read(h.Salt); err != nil {
+		return fmt.Errorf("salt error: %v", err)
+	}
+	dataKey, err := newDataKey()
+	if err != nil {
 		return err
 	}
-	if _, err := f.Write(ciphertext); err != nil {
+	passBytes := []byte(password)
+	h.Password, err = wrapWithPassword(passBytes, h, dataKey)
+	wipe(passBytes)
+	if err != nil {
 		return err
 	}
-
+	v.header = h
+	v.dataKey = dataKey
+	vaultOpened()
 	return nil
 }
 
+// KeyringPassword returns the password gopass keeps in the system keyring
+// for the vault at filepath.
+func KeyringPassword(filepath string) (string, error) {
+	keyID := "vault:" + filepath
+	password, err := keyring.Get(service, keyID)
+	if err != nil {
+		return "", fmt.Errorf("no password found in keyring for %s: %v", filepath, err)
+	}
+	return password, nil
+}
+
 func SaveVaultAccessToConfig(vaultPath string) error {
-	usr, err := user.Current()
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("could not determine current user: %v", err)
+		return fmt.Errorf("could not determine home directory: %v", err)
 	}
 
-	configPath := filepath.Join(usr.HomeDir, ".gopassrc")
+	configPath := filepath.Join(home, ".gopassrc")
 	content := fmt.Sprintf("vault=%s\n", vaultPath)
 
+	// keep any other settings already in the file
+	if existing, err := os.ReadFile(configPath); err == nil {
+		for _, line := range strings.Split(string(existing), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "vault=") {
+				content += line + "\n"
+			}
+		}
+	}
+
 	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
 		return fmt.Errorf("failed to write config: %v", err)
 	}
@@ -215,12 +475,12 @@ func SaveVaultAccessToConfig(vaultPath string) error {
 }
 
 func GetVaultPathFromConfig() (string, error) {
-	usr, err := user.Current()
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("cannot get current user from system")
+		return "", fmt.Errorf("cannot get home directory from system")
 	}
 
-	configPath := filepath.Join(usr.HomeDir, ".gopassrc")
+	configPath := filepath.Join(home, ".gopassrc")
 	file, err := os.Open(configPath)
 	if err != nil {
 		return "", fmt.Errorf("cannot open .gopassrc")
@@ -239,13 +499,40 @@ func GetVaultPathFromConfig() (string, error) {
 	return "", fmt.Errorf("cannot get vault path from .gopassrc")
 }
 
+// GetConfigValue returns the value of a key=value setting in ~/.gopassrc, or
+// an empty string if it isn't set.
+func GetConfigValue(key string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot get home directory from system")
+	}
+
+	file, err := os.Open(filepath.Join(home, ".gopassrc"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("cannot open .gopassrc")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if after, ok := strings.CutPrefix(line, key+"="); ok {
+			return strings.TrimSpace(after), nil
+		}
+	}
+	return "", nil
+}
+
 /* reset keyring on each vault change */
 func GetLastVaultFilePath() (string, error) {
-	usr, err := user.Current()
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	data, err := os.ReadFile(filepath.Join(usr.HomeDir, ".gopassrc_previous"))
+	data, err := os.ReadFile(filepath.Join(home, ".gopassrc_previous"))
 	if err != nil {
 		return "", err
 	}
@@ -253,21 +540,22 @@ func GetLastVaultFilePath() (string, error) {
 }
 
 func SetLastVaultFilePath(vaultPath string) error {
-	usr, err := user.Current()
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(usr.HomeDir, ".gopassrc_previous"), []byte(vaultPath), 0o600)
+	return os.WriteFile(filepath.Join(home, ".gopassrc_previous"), []byte(vaultPath), 0o600)
 }
 
-func ClearOldVaultPasswordIfNeeded(oldVault, newVault string) error {
-	if oldVault != "" && oldVault != newVault {
-		oldKeyID := "vault:" + oldVault
-		fmt.Println(common.Yellow+"Clearing cached password for old vault:"+common.Reset, oldVault)
-		err := keyring.Delete(service, oldKeyID)
-		if err != nil && !errors.Is(err, keyring.ErrNotFound) {
-			return fmt.Errorf("failed to clear old vault password: %w", err)
-		}
+// ClearOldVaultPasswordIfNeeded forgets the keyring password of oldVault
+// when switching to a different vault, and reports whether it did.
+func ClearOldVaultPasswordIfNeeded(oldVault, newVault string) (bool, error) {
+	if oldVault == "" || oldVault == newVault {
+		return false, nil
 	}
-	return nil
+	err := keyring.Delete(service, "vault:"+oldVault)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return false, fmt.Errorf("failed to clear old vault password: %w", err)
+	}
+	return true, nil
 }
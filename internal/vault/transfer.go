@@ -0,0 +1,240 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Item is one entry with its secret fields, as read from or written to
+// another password manager's format.
+type Item struct {
+	Name   string
+	Value  string
+	Fields map[string]string
+	Files  map[string][]byte // attachments, only some formats carry them
+}
+
+// Well-known fields filled by importers.
+const (
+	FieldUsername = "username"
+	FieldURL      = "url"
+	FieldNote     = "note"
+)
+
+// Conflict policies for imported entries whose name is already taken.
+const (
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictOverwrite = "overwrite"
+	ConflictAsk       = "ask" // ImportOptions.Ask decides for each name
+)
+
+// ImportOptions says how an import treats names already in the vault.
+type ImportOptions struct {
+	Policy string // one of the Conflict constants, skip if empty
+	// Ask is called for every taken name under the ask policy and returns
+	// skip, rename or overwrite for it.
+	Ask func(name string) (string, error)
+	// DryRun only fills the report: nothing is changed or saved, and the
+	// ask policy lists the names it would ask about in Conflicts.
+	DryRun bool
+}
+
+// ImportReport says what an import did, or would do in a dry run, with
+// each item.
+type ImportReport struct {
+	Added       []string
+	Overwritten []string
+	Renamed     map[string]string // new name -> name in the source
+	Skipped     []string          // names (or row descriptions) with the reason
+	Unsupported []string          // items the source format has but gopass can't store
+	Conflicts   []string          // taken names the ask policy would ask about (dry run)
+}
+
+// ParseConflict validates a conflict policy name.
+func ParseConflict(s string) (string, error) {
+	switch s {
+	case ConflictSkip, ConflictRename, ConflictOverwrite, ConflictAsk:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, use skip, rename, overwrite or ask", s)
+}
+
+// importItems decides what to do with every item first, resolving name
+// collisions with the vault and within the batch by opts, then stages them
+// all and saves the vault once. Nothing is changed if a decision fails or
+// opts.DryRun is set.
+func (v *Vault) importItems(items []Item, opts ImportOptions, filepath, source string) (*ImportReport, error) {
+	if opts.Policy == ConflictAsk && opts.Ask == nil && !opts.DryRun {
+		return nil, errors.New("the ask conflict policy needs a way to ask")
+	}
+	report := &ImportReport{Renamed: make(map[string]string)}
+	var plan []Item
+	taken := make(map[string]bool)
+	for i, item := range items {
+		if item.Name == "" {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("item %d: no name", i+1))
+			continue
+		}
+		if item.Value == "" {
+			report.Skipped = append(report.Skipped, item.Name+": empty value")
+			continue
+		}
+
+		name := item.Name
+		if v.Has(name) || taken[name] {
+			policy := opts.Policy
+			if policy == ConflictAsk {
+				if opts.DryRun {
+					report.Conflicts = append(report.Conflicts, name)
+					continue
+				}
+				answer, err := opts.Ask(name)
+				if err != nil {
+					return nil, err
+				}
+				if policy, err = ParseConflict(answer); err != nil || policy == ConflictAsk {
+					return nil, fmt.Errorf("invalid answer %q for %s", answer, name)
+				}
+			}
+			switch policy {
+			case ConflictOverwrite:
+				report.Overwritten = append(report.Overwritten, name)
+			case ConflictRename:
+				name = v.freeName(name, taken)
+				report.Renamed[name] = item.Name
+			default:
+				report.Skipped = append(report.Skipped, name+": already exists")
+				continue
+			}
+		} else {
+			report.Added = append(report.Added, name)
+		}
+
+		var files map[string][]byte
+		for _, file := range slices.Sorted(maps.Keys(item.Files)) {
+			content := item.Files[file]
+			if limit := v.AttachmentLimit(); int64(len(content)) > limit {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s: attachment %s is %d bytes, the limit is %d", name, file, len(content), limit))
+				continue
+			}
+			if files == nil {
+				files = make(map[string][]byte)
+			}
+			files[file] = content
+		}
+		item.Name, item.Files = name, files
+		plan = append(plan, item)
+		taken[name] = true
+	}
+
+	if opts.DryRun || len(plan) == 0 {
+		return report, nil
+	}
+	for _, item := range plan {
+		if err := v.stage(item.Name, item.Value, item.Fields); err != nil {
+			return nil, err
+		}
+		for _, file := range slices.Sorted(maps.Keys(item.Files)) {
+			v.addPendingFile(item.Name, file, item.Files[file])
+		}
+	}
+	// the first audit record of a vault saves its log key, keep that in
+	// the same write
+	v.Begin()
+	if err := v.Save(filepath); err != nil {
+		_ = v.Commit()
+		return nil, err
+	}
+	v.logEvent(filepath, "import", "", fmt.Sprintf("%d entries from %s", len(plan), source))
+	if err := v.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// freeName returns "name (2)", "name (3)"... whichever is not taken yet.
+func (v *Vault) freeName(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := name + " (" + strconv.Itoa(n) + ")"
+		if !v.Has(candidate) && !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// stage replaces the value and fields of an entry without saving, dropping
+// its attachments. The index metadata (dates, expiry) is kept.
+func (v *Vault) stage(name, value string, fields map[string]string) error {
+	if value == "" {
+		return fmt.Errorf("value of '%s' cannot be empty", name)
+	}
+	if v.Entries == nil {
+		v.Entries = make(map[string]string)
+	}
+	v.Entries[name] = value
+	r := &record{Value: value}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if r.Fields == nil {
+			r.Fields = make(map[string]string)
+		}
+		r.Fields[field] = value
+	}
+	if v.pending == nil {
+		v.pending = make(map[string]*record)
+	}
+	v.pending[name] = r
+	delete(v.pendingFiles, name)
+	if e, ok := v.index[name]; ok && len(e.Attachments) > 0 {
+		for _, a := range e.Attachments {
+			delete(v.records, a.Record)
+		}
+		e.Attachments = nil
+		v.index[name] = e
+	}
+	return nil
+}
+
+// items decrypts every entry with its fields, sorted by name, and with its
+// attachments if withFiles is set.
+func (v *Vault) items(withFiles bool) ([]Item, error) {
+	var out []Item
+	for _, name := range v.Names() {
+		item := Item{Name: name}
+		_, sealed := v.index[name]
+		if _, pending := v.pending[name]; pending || sealed {
+			r, err := v.record(name)
+			if err != nil {
+				return nil, err
+			}
+			item.Value, item.Fields = r.Value, maps.Clone(r.Fields)
+		}
+		if value, ok := v.Entries[name]; ok {
+			item.Value = value
+		}
+		if withFiles {
+			files, err := v.Attachments(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				content, err := v.Attachment(name, f.Name)
+				if err != nil {
+					return nil, err
+				}
+				if item.Files == nil {
+					item.Files = make(map[string][]byte)
+				}
+				item.Files[f.Name] = content
+			}
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// trashedEntry is a removed entry whose records are kept until the trash is emptied.
+type trashedEntry struct {
+	Entry   indexEntry
+	Deleted time.Time
+}
+
+// TrashedInfo describes an entry in the trash.
+type TrashedInfo struct {
+	Name    string
+	Deleted time.Time
+}
+
+// Drop moves an entry to the trash without saving, the next Save writes
+// the change.
+func (v *Vault) Drop(name string) error {
+	return v.moveToTrash(name, v.path)
+}
+
+// moveToTrash seals the entry if it has unsaved changes and moves its index
+// entry to the trash.
+func (v *Vault) moveToTrash(name, filepath string) error {
+	if err := v.ensureKey(filepath); err != nil {
+		return err
+	}
+	if err := v.sealPending(); err != nil {
+		return err
+	}
+	e, ok := v.index[name]
+	if !ok {
+		return fmt.Errorf("entry with name '%s' doesn't exists", name)
+	}
+	if v.trash == nil {
+		v.trash = make(map[string][]trashedEntry)
+	}
+	v.trash[name] = append(v.trash[name], trashedEntry{Entry: e, Deleted: v.env().Now()})
+	delete(v.index, name)
+	return nil
+}
+
+// Trash lists the removed entries, most recently deleted first.
+func (v *Vault) Trash() []TrashedInfo {
+	var out []TrashedInfo
+	for _, name := range slices.Sorted(maps.Keys(v.trash)) {
+		for _, t := range v.trash[name] {
+			out = append(out, TrashedInfo{Name: name, Deleted: t.Deleted})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b TrashedInfo) int { return b.Deleted.Compare(a.Deleted) })
+	return out
+}
+
+// Undelete restores the most recently removed entry with the given name.
+func (v *Vault) Undelete(name, filepath string) error {
+	items := v.trash[name]
+	if len(items) == 0 {
+		return fmt.Errorf("'%s' is not in the trash", name)
+	}
+	if v.Has(name) {
+		return fmt.Errorf("entry with name '%s' already exists, remove or rename it first", name)
+	}
+	last := items[len(items)-1]
+	if v.index == nil {
+		v.index = make(map[string]indexEntry)
+	}
+	v.index[name] = last.Entry
+	if len(items) == 1 {
+		delete(v.trash, name)
+	} else {
+		v.trash[name] = items[:len(items)-1]
+	}
+	return v.Save(filepath)
+}
+
+// EmptyTrash deletes trashed entries removed more than olderThan ago (all of
+// them for zero) and saves the vault. It returns how many were deleted.
+func (v *Vault) EmptyTrash(olderThan time.Duration, filepath string) (int, error) {
+	cutoff := v.env().Now().Add(-olderThan)
+	purged := 0
+	for name, items := range v.trash {
+		var kept []trashedEntry
+		for _, t := range items {
+			if olderThan == 0 || t.Deleted.Before(cutoff) {
+				v.dropRecords(t.Entry)
+				purged++
+				continue
+			}
+			kept = append(kept, t)
+		}
+		if len(kept) == 0 {
+			delete(v.trash, name)
+		} else {
+			v.trash[name] = kept
+		}
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, v.Save(filepath)
+}
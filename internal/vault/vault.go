@@ -7,13 +7,9 @@ package vault
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"maps"
-	"os"
+	"slices"
 	"strings"
-
-	"github.com/atotto/clipboard"
-	"github.com/prozod/gopass/internal/common"
 )
 
 type VaultKVJson struct {
@@ -21,6 +17,8 @@ type VaultKVJson struct {
 	Value string
 }
 
+// VaultStore is a vault opened once for a program to use, implemented by
+// the public store package.
 type VaultStore interface {
 	Load() error
 	Save() error
@@ -31,110 +29,153 @@ type VaultStore interface {
 }
 
 type Vault struct {
+	// Entries holds plaintext values waiting to be sealed by the next Save.
+	// A loaded vault starts with it empty, use Names, Has and Value to read.
 	Entries map[string]string `json:"entries"`
+
+	header  *header // key stanzas of the file the vault was loaded from
+	dataKey []byte  // key the entries are sealed with, nil until loaded or first saved
+	index   map[string]indexEntry
+	records map[string][]byte
+	pending map[string]*record // records changed since the last Save
+
+	pendingFiles map[string]map[string][]byte // attachments added since the last Save
+
+	trash map[string][]trashedEntry // removed entries, oldest first
+
+	log  *logState // audit log key and head, see auditlog.go
+	path string    // file the vault was loaded from or last saved to
+
+	batch       int      // depth of Begin calls not committed yet
+	batchPath   string   // where Commit writes, set by Save in a batch
+	batchBackup bool     // whether Commit rotates backups, see saveLogHead
+	batchLog    *logMark // audit log before the batch's first record, see Discard
+
+	io              IO    // see SetIO
+	attachmentLimit int64 // see SetAttachmentLimit
 }
 
+// Add adds a new entry and saves the vault.
 func (v *Vault) Add(name, value, filepath string) error {
 	if name == "" || value == "" {
 		return fmt.Errorf("key and value cannot be empty")
 	}
-	if _, exists := v.Entries[name]; exists {
-		fmt.Printf(common.Red+"Entry with name '%s' already exists in '%s', skipping...\n"+common.Reset, name, filepath)
+	if v.Has(name) {
 		return fmt.Errorf("entry with name '%s' already exists", name)
 	}
+	if v.Entries == nil {
+		v.Entries = make(map[string]string)
+	}
 	v.Entries[name] = value
 	if err := v.Save(filepath); err != nil {
-		fmt.Printf("Error adding %v to file: %v. -> %v", os.Args[2], filepath, err)
-		return err
-	} else {
-		fmt.Println(common.Green + "Added " + common.Reset + os.Args[2] + common.Green + " to " + common.Reset + filepath)
-		return nil
+		return fmt.Errorf("failed to add %s to %s: %w", name, filepath, err)
 	}
+	v.logEvent(filepath, "add", name, "")
+	return nil
 }
 
-func (v Vault) Get(name string) (string, error) {
-	value, exists := v.Entries[name]
-	if exists {
-		err := clipboard.WriteAll(value)
-		if err != nil {
-			log.Fatalf("Failed to copy to clipboard: %v", err)
-		}
-		fmt.Printf("Copied value for \"%s\" to clipboard.\n", name)
-		return value, nil
-	} else {
-		return "", fmt.Errorf("'%s' doesnt exist in vault", name)
+// Put adds a new entry without saving, the next Save writes it.
+func (v *Vault) Put(name, value string) error {
+	if name == "" || value == "" {
+		return fmt.Errorf("key and value cannot be empty")
+	}
+	if v.Has(name) {
+		return fmt.Errorf("entry with name '%s' already exists", name)
+	}
+	return v.stage(name, value, nil)
+}
+
+// Get copies the value of an entry to the clipboard and returns it.
+func (v *Vault) Get(name string) (string, error) {
+	value, err := v.Value(name)
+	if err != nil {
+		return "", err
+	}
+	v.logEvent(v.path, "get", name, "")
+	if err := v.env().Clipboard.WriteAll(value); err != nil {
+		return "", fmt.Errorf("failed to copy to clipboard: %w", err)
 	}
+	return value, nil
 }
 
+// Remove moves an entry to the trash, see Undelete and EmptyTrash.
 func (v *Vault) Remove(name, filepath string) error {
-	if _, exists := v.Entries[name]; exists {
-		delete(v.Entries, name)
-		fmt.Println(common.Green + "Deleted " + common.Reset + name + common.Green + " from vault" + common.Reset)
-		return v.Save(filepath)
+	if v.Has(name) {
+		if err := v.moveToTrash(name, filepath); err != nil {
+			return err
+		}
+		if err := v.Save(filepath); err != nil {
+			return err
+		}
+		v.logEvent(filepath, "remove", name, "moved to trash")
+		return nil
 	} else {
 		return fmt.Errorf("entry with name '%s' doesn't exists", name)
 	}
 }
 
-func (v Vault) List(args ...string) {
-	fmt.Println(common.Green + "INFO: " + common.Reset + "Entries are separated by ':' (<" + common.Blue + "name" + common.Reset + ">:<" + common.Yellow + "value" + common.Reset + ">)")
-	fmt.Println()
-	fmt.Println("---------- VAULT STORAGE ----------")
-	if len(args) > 0 {
-		if args[0] == "-expose" {
-			for n, v := range v.Entries {
-				fmt.Printf("|> "+common.Blue+"%s"+common.Reset+":"+common.Yellow+"%s"+common.Reset+"\n", n, v)
-			}
-		} else {
-			fmt.Printf(common.Yellow+"WARNING: "+common.Reset+"Unknown argument: %s\n", args[0])
+// Purge deletes an entry for good, skipping the trash.
+func (v *Vault) Purge(name, filepath string) error {
+	if v.Has(name) {
+		v.delete(name)
+		if err := v.Save(filepath); err != nil {
+			return err
 		}
+		v.logEvent(filepath, "purge", name, "deleted permanently")
+		return nil
 	} else {
-		fmt.Println(common.Purple + "Hidden mode, use flag '-expose' to display passwords." + common.Reset)
-		for n, v := range v.Entries {
-			fmt.Printf("|> "+common.Blue+"%s"+common.Reset+":"+common.Yellow+"%s"+common.Reset+"\n", n, strings.Repeat("*", len(strings.Split(v, ""))))
+		return fmt.Errorf("entry with name '%s' doesn't exists", name)
+	}
+}
+
+// Find returns the sorted names containing query, ignoring case. No value is decrypted.
+func (v *Vault) Find(query string) []string {
+	query = strings.ToLower(query)
+	var out []string
+	for _, name := range v.Names() {
+		if strings.Contains(strings.ToLower(name), query) {
+			out = append(out, name)
 		}
 	}
-	fmt.Println("-----------------------------------")
-	fmt.Println()
+	return out
 }
 
-func (v Vault) Export(path string) error {
-	fmt.Println(common.Green + "Exporting vault to JSON..." + common.Reset)
+// Export writes every entry to path as a flat JSON object.
+func (v *Vault) Export(path string) error {
 	dataToExport := make(map[string]string)
-	maps.Copy(dataToExport, v.Entries)
+	for _, name := range v.Names() {
+		value, err := v.Value(name)
+		if err != nil {
+			return err
+		}
+		dataToExport[name] = value
+	}
 	data, err := json.MarshalIndent(dataToExport, "", "\t")
 	if err != nil {
-		fmt.Println("Error exporting to JSON. ", err)
+		return fmt.Errorf("failed to encode JSON: %w", err)
 	}
-	err = os.WriteFile(path, data, 0o644)
-	if err != nil {
-		fmt.Printf("Error creating JSON file")
+	if err := WritePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
 	}
-	return err
+	v.logEvent(v.path, "export", "", fmt.Sprintf("%d entries to %s", len(dataToExport), path))
+	return nil
 }
 
-func (v Vault) Import(jsonFile []byte, filepath string) error {
-	fmt.Println(common.Green + "Importing JSON to vault..." + common.Reset)
-
+// Import imports a flat JSON object of names and values, resolving name
+// collisions as opts says, and saves the vault once.
+func (v *Vault) Import(jsonFile []byte, filepath string, opts ImportOptions) (*ImportReport, error) {
 	var raw map[string]any
 	if err := json.Unmarshal(jsonFile, &raw); err != nil {
-		return fmt.Errorf("invalid JSON format: %w", err)
+		return nil, fmt.Errorf("invalid JSON format: %w", err)
 	}
 
-	dataToImport := make(map[string]string)
-	for name, val := range raw {
-		strVal, ok := val.(string)
+	items := make([]Item, 0, len(raw))
+	for _, name := range slices.Sorted(maps.Keys(raw)) {
+		strVal, ok := raw[name].(string)
 		if !ok {
-			return fmt.Errorf("invalid value for key '%s': only flat key-value strings are supported", name)
+			return nil, fmt.Errorf("invalid value for key '%s': only flat key-value strings are supported (Bitwarden exports need --format bitwarden)", name)
 		}
-		dataToImport[name] = strVal
+		items = append(items, Item{Name: name, Value: strVal})
 	}
-
-	for name, value := range dataToImport {
-		if err := v.Add(name, value, filepath); err != nil {
-			fmt.Println(err)
-		}
-	}
-
-	return nil
+	return v.importItems(items, opts, filepath, "JSON")
 }
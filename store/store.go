@@ -0,0 +1,280 @@
+// Package store lets Go programs use a gopass vault as a library.
+//
+// A Store is opened once with the vault's path and a source for its
+// password. Unlike the gopass command it never prints, prompts, touches the
+// clipboard or writes to the keyring, and every failure is returned as an
+// error. Changes are kept in memory until Save writes them, encrypted, in
+// one atomic write, and then logs them to the vault's audit log. Get logs
+// every read at once, or with the next Save, Load or Close while changes are
+// unsaved. All methods are safe to call from multiple goroutines; two
+// processes writing the same vault file at once are not coordinated.
+//
+//	s, err := store.Open("/srv/app/secrets.dat", store.Password(os.Getenv("VAULT_PASSWORD")))
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	token, err := s.Get("github/token")
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/prozod/gopass/internal/vault"
+)
+
+var (
+	// ErrNotFound is returned for names that aren't in the vault.
+	ErrNotFound = errors.New("entry not found")
+	// ErrExists is returned by Add for names already in the vault.
+	ErrExists = errors.New("entry already exists")
+	// ErrClosed is returned once the store is closed.
+	ErrClosed = errors.New("store is closed")
+	// ErrWrongPassword is returned when the password doesn't open the vault.
+	ErrWrongPassword = vault.ErrWrongPassword
+)
+
+// Credentials supplies the vault password whenever the vault is opened,
+// unless the local identity (see gopass keygen) is one of its recipients.
+type Credentials func() (string, error)
+
+// Password returns Credentials for a fixed password.
+func Password(password string) Credentials {
+	return func() (string, error) { return password, nil }
+}
+
+// Keyring returns Credentials reading the password the gopass command keeps
+// in the system keyring for the vault at path.
+func Keyring(path string) Credentials {
+	return func() (string, error) { return vault.KeyringPassword(path) }
+}
+
+// Read lets Credentials stand in for the vault's password reader.
+func (c Credentials) Read(string) (string, error) {
+	return c()
+}
+
+// change is an unsaved Add or Remove, logged to the audit log by Save, or
+// a Get made while changes were unsaved.
+type change struct {
+	op, entry, detail string
+}
+
+// logChanges appends the records of changes to the audit log of v, saving
+// the vault once for all of them.
+func logChanges(v *vault.Vault, path string, changes []change) error {
+	v.Begin()
+	for _, c := range changes {
+		if err := v.AppendLog(path, c.op, c.entry, c.detail); err != nil {
+			_ = v.Commit()
+			return err
+		}
+	}
+	return v.Commit()
+}
+
+// reads returns the Get records among changes, which must be logged even
+// when the changes they came with are dropped.
+func reads(changes []change) []change {
+	var out []change
+	for _, c := range changes {
+		if c.op == "get" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Store is an open vault. It implements the VaultStore interface of the
+// gopass vault package.
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	creds   Credentials
+	v       *vault.Vault // nil once closed
+	changes []change
+}
+
+var _ vault.VaultStore = (*Store)(nil)
+
+// Open opens the existing vault at path.
+func Open(path string, creds Credentials) (*Store, error) {
+	v, err := open(path, creds)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, creds: creds, v: v}, nil
+}
+
+// open opens the vault at path with warnings discarded and the clipboard
+// out of reach.
+func open(path string, creds Credentials) (*vault.Vault, error) {
+	v, err := vault.OpenFile(path, creds)
+	if err != nil {
+		return nil, err
+	}
+	v.SetIO(quiet)
+	return v, nil
+}
+
+// quiet is the vault IO of a store: it never prints or touches the
+// clipboard.
+var quiet = vault.IO{Out: io.Discard, Clipboard: noClipboard{}}
+
+type noClipboard struct{}
+
+func (noClipboard) WriteAll(string) error {
+	return errors.New("a store has no clipboard")
+}
+
+// Create creates a new empty vault at path, protected by the password from
+// creds, and opens it. The file must not exist yet.
+func Create(path string, creds Credentials) (*Store, error) {
+	password, err := creds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %v", err)
+	}
+	v, err := vault.CreateFile(path, password)
+	if err != nil {
+		return nil, err
+	}
+	v.SetIO(quiet)
+	return &Store{path: path, creds: creds, v: v}, nil
+}
+
+// Load reads the vault from disk again, dropping unsaved changes.
+func (s *Store) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return ErrClosed
+	}
+	v, err := open(s.path, s.creds)
+	if err != nil {
+		return err
+	}
+	s.v.Close()
+	changes := s.changes
+	s.v, s.changes = v, nil
+	if err := logChanges(v, s.path, reads(changes)); err != nil {
+		return fmt.Errorf("vault loaded, but writing the audit log failed: %w", err)
+	}
+	return nil
+}
+
+// Save writes the changes made since the last Save or Load, if any.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return ErrClosed
+	}
+	if len(s.changes) == 0 {
+		return nil
+	}
+	if err := s.v.Save(s.path); err != nil {
+		return err
+	}
+	changes := s.changes
+	s.changes = nil
+	if err := logChanges(s.v, s.path, changes); err != nil {
+		return fmt.Errorf("vault saved, but writing the audit log failed: %w", err)
+	}
+	return nil
+}
+
+// Add adds a new entry. It fails with ErrExists if the name is taken.
+func (s *Store) Add(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return ErrClosed
+	}
+	if s.v.Has(name) {
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	if err := s.v.Put(name, value); err != nil {
+		return err
+	}
+	s.changes = append(s.changes, change{op: "add", entry: name})
+	return nil
+}
+
+// Get decrypts and returns the value of an entry and logs the read. No value
+// is returned if the read can't be logged.
+func (s *Store) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return "", ErrClosed
+	}
+	if !s.v.Has(name) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	value, err := s.v.Value(name)
+	if err != nil {
+		return "", err
+	}
+	read := change{op: "get", entry: name}
+	if len(s.changes) > 0 {
+		// logging now would save the unsaved changes with the log head
+		s.changes = append(s.changes, read)
+		return value, nil
+	}
+	if err := logChanges(s.v, s.path, []change{read}); err != nil {
+		return "", fmt.Errorf("writing the audit log failed: %w", err)
+	}
+	return value, nil
+}
+
+// Remove moves an entry to the vault's trash, where the gopass command can
+// restore it from.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return ErrClosed
+	}
+	if !s.v.Has(name) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err := s.v.Drop(name); err != nil {
+		return err
+	}
+	s.changes = append(s.changes, change{op: "remove", entry: name, detail: "moved to trash"})
+	return nil
+}
+
+// List returns the sorted names of all entries without decrypting any
+// value, or nil once the store is closed.
+func (s *Store) List() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.v == nil {
+		return nil
+	}
+	return s.v.Names()
+}
+
+// Close wipes the vault key and unsaved values from memory. Unsaved changes
+// are lost, reads made with them are still logged; the store can't be used
+// afterwards.
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.v == nil {
+		return
+	}
+	s.v.Close()
+	if r := reads(s.changes); len(r) > 0 {
+		// the vault as it is on disk, without the dropped changes
+		if v, err := open(s.path, s.creds); err == nil {
+			_ = logChanges(v, s.path, r)
+			v.Close()
+		}
+	}
+	s.v, s.changes = nil, nil
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prozod/gopass/internal/vault"
+)
+
+// hermetic keeps the tests away from the real home directory and identity.
+// The keyring is deliberately not mocked: the store must never need it.
+func hermetic(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("GOPASS_IDENTITY", filepath.Join(dir, "no-identity"))
+	return dir
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	path := filepath.Join(hermetic(t), "lib.dat")
+
+	// nothing may be printed
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	s, err := Create(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, Password("pw")); err == nil {
+		t.Fatal("create must not overwrite an existing vault")
+	}
+	if err := s.Add("github", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("email", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("github", "other"); !errors.Is(err, ErrExists) {
+		t.Fatalf("duplicate add: err = %v", err)
+	}
+	if value, err := s.Get("github"); err != nil || value != "token" {
+		t.Fatalf("unsaved entry: %q, %v", value, err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, Password("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	other, err := Open(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.List(); !slices.Equal(got, []string{"email", "github"}) {
+		t.Fatalf("reopened vault lists %v", got)
+	}
+	if _, err := other.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing entry: err = %v", err)
+	}
+	if err := other.Remove("email"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	if _, err := other.Get("github"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("closed store: err = %v", err)
+	}
+
+	if err := s.Add("unsaved", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.List(); !slices.Equal(got, []string{"github"}) {
+		t.Fatalf("after load: %v, want the removal from the other store and no unsaved entry", got)
+	}
+	s.Close()
+
+	w.Close()
+	if out, _ := io.ReadAll(r); len(out) != 0 {
+		t.Fatalf("the store printed %q", out)
+	}
+}
+
+func TestStoreConcurrentUse(t *testing.T) {
+	path := filepath.Join(hermetic(t), "concurrent.dat")
+	s, err := Create(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				name := fmt.Sprintf("g%d/%02d", g, i)
+				if err := s.Add(name, name); err != nil {
+					t.Error(err)
+					return
+				}
+				if value, err := s.Get(name); err != nil || value != name {
+					t.Errorf("%s = %q, %v", name, value, err)
+				}
+				_ = s.List()
+				if i%10 == 0 {
+					if err := s.Save(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if n := len(reopened.List()); n != 200 {
+		t.Fatalf("expected 200 entries, got %d", n)
+	}
+	if value, _ := reopened.Get("g3/07"); value != "g3/07" {
+		t.Fatalf("g3/07 = %q", value)
+	}
+}
+
+func TestStoreLogsReads(t *testing.T) {
+	path := filepath.Join(hermetic(t), "reads.dat")
+	s, err := Create(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("github", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("github"); err != nil {
+		t.Fatal(err)
+	}
+	// a read with unsaved changes is logged without saving them
+	if err := s.Add("unsaved", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("github"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	v, err := vault.OpenFile(path, Password("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.Has("unsaved") {
+		t.Fatal("logging a read saved an unsaved change")
+	}
+	records, err := v.Log(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, r := range records {
+		ops = append(ops, r.Op+":"+r.Entry)
+	}
+	if got := strings.Join(ops, " "); got != "add:github get:github get:github" {
+		t.Fatalf("unexpected log %q", got)
+	}
+	if problems, err := v.VerifyLog(path); err != nil || len(problems) != 0 {
+		t.Fatalf("log doesn't verify: %v (%v)", problems, err)
+	}
+}